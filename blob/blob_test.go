@@ -0,0 +1,176 @@
+package blob
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yellowssi/SeaStorage-TP/crypto"
+)
+
+func newTestStore(t *testing.T) (*FileStore, func()) {
+	dir, err := ioutil.TempDir("", "blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs, func() { os.RemoveAll(dir) }
+}
+
+func TestFileStore_Put(t *testing.T) {
+	fs, clean := newTestStore(t)
+	defer clean()
+	data := []byte("fragment")
+	hash := crypto.SHA512HexFromBytes(data)
+	_, err := fs.Put("owner", hash, bytes.NewReader([]byte("corrupted")))
+	if err != ErrHashMismatch {
+		t.Error("data mismatching the hash shouldn't be stored")
+	}
+	n, err := fs.Put("owner", hash, bytes.NewReader(data))
+	if err != nil || n != int64(len(data)) {
+		t.Fatal(err)
+	}
+	_, err = fs.Put("other", hash, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage, err := fs.Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Used != int64(len(data)) || usage.Blobs != 1 || usage.References != 2 {
+		t.Errorf("invalid usage: %+v", usage)
+	}
+	r, err := fs.Open("owner", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil || !bytes.Equal(result, data) {
+		t.Error("fragment should be read")
+	}
+
+	err = ioutil.WriteFile(fs.blobPath(hash), []byte("modified"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = fs.Open("owner", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ioutil.ReadAll(r)
+	r.Close()
+	if err != ErrHashMismatch {
+		t.Error("corrupted fragment should be detected")
+	}
+}
+
+func TestFileStore_Delete(t *testing.T) {
+	fs, clean := newTestStore(t)
+	defer clean()
+	data := []byte("fragment")
+	hash := crypto.SHA512HexFromBytes(data)
+	// The owner stores the same fragment for two files, and the other owner stores it once.
+	for i, owner := range []string{"owner", "owner", "other"} {
+		_, err := fs.Put(owner, hash, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = fs.Reference(owner, hash, uint64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, ref := range []string{"link", "dir"} {
+		err := fs.Share("owner", hash, ref, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := fs.Share("owner", hash, "link", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, err := fs.IsShared("owner", hash)
+	if err != nil || !shared {
+		t.Error("fragment should be shared by the remaining share")
+	}
+	err = fs.Delete("owner", hash, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs.Delete("owner", hash, 0) != ErrNotFound {
+		t.Error("reference should be removed")
+	}
+	r, err := fs.Open("owner", hash)
+	if err != nil {
+		t.Fatal("fragment held by another record should be kept")
+	}
+	r.Close()
+	err = fs.Delete("owner", hash, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fs.IsShared("owner", hash); err != ErrNotFound {
+		t.Error("shares should be removed with the last reference")
+	}
+	_, err = os.Stat(fs.blobPath(hash))
+	if err != nil {
+		t.Error("fragment referenced by other owner should be kept")
+	}
+	err = fs.Delete("other", hash, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(fs.blobPath(hash))
+	if !os.IsNotExist(err) {
+		t.Error("fragment not referenced should be removed")
+	}
+}
+
+func TestFileStore_GC(t *testing.T) {
+	fs, clean := newTestStore(t)
+	defer clean()
+	data := []byte("orphan")
+	hash := crypto.SHA512HexFromBytes(data)
+	_, err := fs.writeFile(fs.blobPath(hash), bytes.NewReader(data), hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(fs.Root, tmpDir, "write-left"), data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := fs.GC(time.Now().Add(2 * TmpExpiration))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Error("orphan fragment should be collected")
+	}
+	tmps, _ := ioutil.ReadDir(filepath.Join(fs.Root, tmpDir))
+	if len(tmps) != 0 {
+		t.Error("expired temporary files should be removed")
+	}
+
+	uploaded := []byte("uploaded")
+	_, err = fs.Put("owner", crypto.SHA512HexFromBytes(uploaded), bytes.NewReader(uploaded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err = fs.GC(time.Now().Add(2 * TmpExpiration))
+	if err != nil || count != 0 {
+		t.Error("fragment uploaded recently should be kept")
+	}
+	count, err = fs.GC(time.Now().Add(2 * UploadExpiration))
+	if err != nil || count != 1 {
+		t.Error("fragment uploaded without stored record should be collected")
+	}
+}
@@ -0,0 +1,2 @@
+// Package blob provides the local storage of fragments in seas.
+package blob
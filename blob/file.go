@@ -0,0 +1,483 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blob
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The layout of FileStore under the root directory.
+// The blobs and references are sharded by the first bytes of hash.
+const (
+	blobsDir = "blobs"
+	refsDir  = "refs"
+	tmpDir   = "tmp"
+)
+
+// TmpExpiration is the duration after which the temporary files left by failed writes are removed by GC.
+var TmpExpiration = time.Hour
+
+// UploadExpiration is the duration after which the upload references without stored records are removed by GC.
+var UploadExpiration = 24 * time.Hour
+
+// The names of reference files in the directory of owner.
+const (
+	uploadRef       = "upload"
+	storedRefPrefix = "stored-"
+	shareRefPrefix  = "share-"
+)
+
+// FileStore stores the fragments on the filesystem by their hash.
+// Each owner referencing the fragment has a directory of reference files,
+// one for each stored record, the upload and each share.
+type FileStore struct {
+	mutex sync.Mutex
+	Root  string
+}
+
+// NewFileStore is the construct for FileStore, the directories are created if they don't exist.
+func NewFileStore(root string) (*FileStore, error) {
+	for _, dir := range []string{blobsDir, refsDir, tmpDir} {
+		err := os.MkdirAll(filepath.Join(root, dir), 0700)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &FileStore{Root: root}, nil
+}
+
+// Check the hash whether is the hex of SHA512.
+func validHash(h string) error {
+	data, err := hex.DecodeString(h)
+	if err != nil || len(data) != sha512.Size {
+		return errors.New("invalid hash: " + h)
+	}
+	return nil
+}
+
+// Check the name whether can be used as the name of file.
+func validName(name string) error {
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+		return errors.New("invalid name: " + name)
+	}
+	return nil
+}
+
+func shard(h string) string {
+	return filepath.Join(h[:2], h[2:4])
+}
+
+func (fs *FileStore) blobPath(h string) string {
+	return filepath.Join(fs.Root, blobsDir, shard(h), h)
+}
+
+func (fs *FileStore) refsPath(h string) string {
+	return filepath.Join(fs.Root, refsDir, shard(h), h)
+}
+
+// Returns the directory of references of owner.
+func (fs *FileStore) ownerPath(owner, h string) (string, error) {
+	err := validHash(h)
+	if err != nil {
+		return "", err
+	}
+	err = validName(owner)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(fs.refsPath(h), owner), nil
+}
+
+func storedRef(id uint64) string {
+	return storedRefPrefix + strconv.FormatUint(id, 10)
+}
+
+// Write the data into the path atomically by renaming the temporary file.
+// The data is hashed while writing, if the hash is provided, the data should match it.
+func (fs *FileStore) writeFile(p string, r io.Reader, h string) (int64, error) {
+	tmp, err := ioutil.TempFile(filepath.Join(fs.Root, tmpDir), "write-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	sum := sha512.New()
+	n, err := io.Copy(io.MultiWriter(tmp, sum), r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+	if h != "" && hex.EncodeToString(sum.Sum(nil)) != h {
+		return n, ErrHashMismatch
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0700)
+	if err != nil {
+		return n, err
+	}
+	return n, os.Rename(tmp.Name(), p)
+}
+
+// Write the empty reference file.
+func (fs *FileStore) writeRef(p string) error {
+	_, err := fs.writeFile(p, bytes.NewReader(nil), "")
+	return err
+}
+
+// Returns whether the owner holds the fragment by the upload or any stored record.
+func holds(dir string) (bool, error) {
+	refs, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	for _, ref := range refs {
+		if ref.Name() == uploadRef || strings.HasPrefix(ref.Name(), storedRefPrefix) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Returns ErrNotFound if the owner doesn't hold the fragment.
+func checkHolds(dir string) error {
+	ok, err := holds(dir)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Put store the fragment read from r and add the upload reference of owner, it returns the size stored.
+// The fragment stored already isn't written again.
+func (fs *FileStore) Put(owner, hash string, r io.Reader) (int64, error) {
+	dir, err := fs.ownerPath(owner, hash)
+	if err != nil {
+		return 0, err
+	}
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	p := fs.blobPath(hash)
+	info, err := os.Stat(p)
+	var n int64
+	if err == nil {
+		n = info.Size()
+	} else if os.IsNotExist(err) {
+		n, err = fs.writeFile(p, r, hash)
+		if err != nil {
+			return n, err
+		}
+	} else {
+		return 0, err
+	}
+	// The upload reference is rewritten, so that it expires from the latest upload.
+	return n, fs.writeRef(filepath.Join(dir, uploadRef))
+}
+
+// Open returns the reader of fragment held by the owner.
+// The reader returns ErrHashMismatch at the end if the data is corrupted.
+func (fs *FileStore) Open(owner, hash string) (io.ReadCloser, error) {
+	dir, err := fs.ownerPath(owner, hash)
+	if err != nil {
+		return nil, err
+	}
+	err = checkHolds(dir)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(fs.blobPath(hash))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &verifyReader{file: f, hash: hash, sum: sha512.New()}, nil
+}
+
+// Size returns the size of fragment held by the owner.
+func (fs *FileStore) Size(owner, hash string) (int64, error) {
+	dir, err := fs.ownerPath(owner, hash)
+	if err != nil {
+		return 0, err
+	}
+	err = checkHolds(dir)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(fs.blobPath(hash))
+	if os.IsNotExist(err) {
+		return 0, ErrNotFound
+	} else if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Reference add the reference of owner by the stored record with the id, replacing the upload reference.
+func (fs *FileStore) Reference(owner, hash string, storedID uint64) error {
+	dir, err := fs.ownerPath(owner, hash)
+	if err != nil {
+		return err
+	}
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	_, err = os.Stat(fs.blobPath(hash))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	err = fs.writeRef(filepath.Join(dir, storedRef(storedID)))
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(dir, uploadRef))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Delete remove the reference of owner by the stored record with the id, the fragment isn't held is removed.
+func (fs *FileStore) Delete(owner, hash string, storedID uint64) error {
+	dir, err := fs.ownerPath(owner, hash)
+	if err != nil {
+		return err
+	}
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	err = os.Remove(filepath.Join(dir, storedRef(storedID)))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	err = fs.collectOwner(owner, hash)
+	if err != nil {
+		return err
+	}
+	_, err = fs.collect(hash)
+	return err
+}
+
+// Remove the references of owner if it doesn't hold the fragment, the shares are removed with them.
+func (fs *FileStore) collectOwner(owner, hash string) error {
+	dir := filepath.Join(fs.refsPath(hash), owner)
+	ok, err := holds(dir)
+	if err != nil || ok {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// Remove the fragment with the hash if it isn't referenced.
+// It returns whether the fragment is removed.
+func (fs *FileStore) collect(hash string) (bool, error) {
+	owners, err := ioutil.ReadDir(fs.refsPath(hash))
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if len(owners) > 0 {
+		return false, nil
+	}
+	err = os.Remove(fs.refsPath(hash))
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	err = os.Remove(fs.blobPath(hash))
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+// Share add or remove the share of fragment held by the owner, the share is identified by ref.
+// The fragment not held by the owner can't be shared, and the share not added can't be removed.
+func (fs *FileStore) Share(owner, hash, ref string, shared bool) error {
+	dir, err := fs.ownerPath(owner, hash)
+	if err != nil {
+		return err
+	}
+	err = validName(shareRefPrefix + ref)
+	if err != nil || ref == "" {
+		return errors.New("invalid reference of share: " + ref)
+	}
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	p := filepath.Join(dir, shareRefPrefix+ref)
+	if !shared {
+		err = os.Remove(p)
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	err = checkHolds(dir)
+	if err != nil {
+		return err
+	}
+	return fs.writeRef(p)
+}
+
+// IsShared returns whether the fragment held by the owner has any share.
+func (fs *FileStore) IsShared(owner, hash string) (bool, error) {
+	dir, err := fs.ownerPath(owner, hash)
+	if err != nil {
+		return false, err
+	}
+	refs, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return false, ErrNotFound
+	} else if err != nil {
+		return false, err
+	}
+	for _, ref := range refs {
+		if strings.HasPrefix(ref.Name(), shareRefPrefix) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Usage returns the size and count of blobs and the count of references in the store.
+func (fs *FileStore) Usage() (Usage, error) {
+	var usage Usage
+	err := filepath.Walk(filepath.Join(fs.Root, blobsDir), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			usage.Used += info.Size()
+			usage.Blobs++
+		}
+		return nil
+	})
+	if err != nil {
+		return usage, err
+	}
+	err = filepath.Walk(filepath.Join(fs.Root, refsDir), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			usage.References++
+		}
+		return nil
+	})
+	return usage, err
+}
+
+// GC remove the upload references and the temporary files expired at the time, and the blobs not referenced.
+// It returns the count of blobs removed.
+func (fs *FileStore) GC(now time.Time) (int, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	tmps, err := ioutil.ReadDir(filepath.Join(fs.Root, tmpDir))
+	if err != nil {
+		return 0, err
+	}
+	for _, tmp := range tmps {
+		if now.Sub(tmp.ModTime()) > TmpExpiration {
+			err = os.Remove(filepath.Join(fs.Root, tmpDir, tmp.Name()))
+			if err != nil && !os.IsNotExist(err) {
+				return 0, err
+			}
+		}
+	}
+	hashes := make([]string, 0)
+	err = filepath.Walk(filepath.Join(fs.Root, blobsDir), func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			hashes = append(hashes, info.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, h := range hashes {
+		if validHash(h) != nil {
+			continue
+		}
+		owners, err := ioutil.ReadDir(fs.refsPath(h))
+		if err != nil && !os.IsNotExist(err) {
+			return count, err
+		}
+		for _, owner := range owners {
+			upload := filepath.Join(fs.refsPath(h), owner.Name(), uploadRef)
+			info, err := os.Stat(upload)
+			if err == nil && now.Sub(info.ModTime()) > UploadExpiration {
+				err = os.Remove(upload)
+			}
+			if err != nil && !os.IsNotExist(err) {
+				return count, err
+			}
+			err = fs.collectOwner(owner.Name(), h)
+			if err != nil {
+				return count, err
+			}
+		}
+		removed, err := fs.collect(h)
+		if err != nil {
+			return count, err
+		}
+		if removed {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// verifyReader verify the data of blob by the hash when reaching the end.
+type verifyReader struct {
+	file *os.File
+	hash string
+	sum  hash.Hash
+}
+
+func (vr *verifyReader) Read(p []byte) (int, error) {
+	n, err := vr.file.Read(p)
+	vr.sum.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(vr.sum.Sum(nil)) != vr.hash {
+		return n, ErrHashMismatch
+	}
+	return n, err
+}
+
+func (vr *verifyReader) Close() error {
+	return vr.file.Close()
+}
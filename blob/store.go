@@ -0,0 +1,70 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package blob
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	// ErrNotFound is returned when the fragment isn't stored.
+	ErrNotFound = errors.New("fragment doesn't exist")
+	// ErrHashMismatch is returned when the data doesn't match the hash of fragment.
+	ErrHashMismatch = errors.New("hash of fragment mismatch")
+)
+
+// Store is the local storage of fragments in the sea.
+// The fragments are addressed by the hash, and referenced by the owners address.
+// Each owner holds the fragment by the records stored in the sea with their IDs,
+// the fragment uploaded is held by the upload reference until its record is stored.
+// The shares of fragment are referenced separately, so that revoking one share doesn't affect others.
+type Store interface {
+	// Put store the fragment read from r and add the upload reference of owner, it returns the size stored.
+	// The data should match the hash.
+	Put(owner, hash string, r io.Reader) (int64, error)
+	// Open returns the reader of fragment held by the owner.
+	// The data is verified by the hash while reading.
+	Open(owner, hash string) (io.ReadCloser, error)
+	// Size returns the size of fragment held by the owner.
+	Size(owner, hash string) (int64, error)
+	// Reference add the reference of owner by the stored record with the id, replacing the upload reference.
+	// It returns ErrNotFound if the fragment isn't stored.
+	Reference(owner, hash string, storedID uint64) error
+	// Delete remove the reference of owner by the stored record with the id, the fragment isn't held is removed.
+	// It returns ErrNotFound if the fragment isn't referenced by the record.
+	Delete(owner, hash string, storedID uint64) error
+	// Share add or remove the share of fragment held by the owner, the share is identified by ref.
+	Share(owner, hash, ref string, shared bool) error
+	// IsShared returns whether the fragment held by the owner has any share.
+	IsShared(owner, hash string) (bool, error)
+	// Usage returns the usage of store.
+	Usage() (Usage, error)
+}
+
+// Usage is the usage of store, Used is in bytes as the capacity declared by the sea.
+type Usage struct {
+	Used       int64
+	Blobs      int
+	References int
+}
+
+// Free returns the free space of the capacity.
+func (u Usage) Free(capacity int64) int64 {
+	if u.Used >= capacity {
+		return 0
+	}
+	return capacity - u.Used
+}
@@ -16,10 +16,12 @@ package crypto
 
 import (
 	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/hex"
+	"errors"
 	ellcurv "github.com/btcsuite/btcd/btcec"
 )
 
@@ -151,22 +153,40 @@ func AESKeyEncryptedByPublicKey(key, publicKey string) []byte {
 	return result
 }
 
+// AESKeyEncryption encrypt the data by AES-GCM with random nonce.
+// The result is the nonce followed by the sealed data.
 func AESKeyEncryption(key, data string) (result []byte, err error) {
-	cipher, err := aes.NewCipher(HexToBytes(key))
+	aead, err := newAESGCM(key)
 	if err != nil {
 		return nil, err
 	}
-	cipher.Encrypt(result, HexToBytes(data))
-	return
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, HexToBytes(data), nil), nil
 }
 
+// AESKeyDecryption decrypt the data encrypted by AESKeyEncryption.
 func AESKeyDecryption(key, data string) (result []byte, err error) {
-	cipher, err := aes.NewCipher(HexToBytes(key))
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed := HexToBytes(data)
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+func newAESGCM(key string) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(HexToBytes(key))
 	if err != nil {
 		return nil, err
 	}
-	cipher.Decrypt(result, HexToBytes(data))
-	return
+	return cipher.NewGCM(block)
 }
 
 // Convert between Hex and Bytes
@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -9,3 +10,91 @@ func TestSHA512(t *testing.T) {
 	println(hash)
 	println(hash[:64])
 }
+
+func TestAESKeyEncryption(t *testing.T) {
+	key := NewAESKey(256)
+	data := BytesToHex([]byte("SeaStorage"))
+	result, err := AESKeyEncryption(key, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := AESKeyDecryption(key, BytesToHex(result))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if BytesToHex(plain) != data {
+		t.Error("decrypted data doesn't match")
+	}
+	result[len(result)-1] ^= 1
+	_, err = AESKeyDecryption(key, BytesToHex(result))
+	if err == nil {
+		t.Error("modified data should be rejected")
+	}
+}
+
+func TestAESStream(t *testing.T) {
+	key := NewAESKey(128)
+	for _, size := range []int{0, 1, AESStreamChunkSize, 3*AESStreamChunkSize + 7} {
+		data := GenerateRandomAESKey(256)
+		data = bytes.Repeat(data, size/len(data)+1)[:size]
+		var sealed, plain bytes.Buffer
+		err := AESStreamEncryption(key, bytes.NewReader(data), &sealed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = AESStreamDecryption(key, bytes.NewReader(sealed.Bytes()), &plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(sealed.Len()) != AESStreamSize(int64(size)) {
+			t.Errorf("invalid size of encrypted stream, size: %d", size)
+		}
+		if !bytes.Equal(plain.Bytes(), data) {
+			t.Errorf("decrypted stream doesn't match, size: %d", size)
+		}
+	}
+}
+
+func TestAESStreamTruncated(t *testing.T) {
+	key := NewAESKey(256)
+	data := make([]byte, 2*AESStreamChunkSize+1)
+	var sealed bytes.Buffer
+	err := AESStreamEncryption(key, bytes.NewReader(data), &sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := sealed.Bytes()[:sealed.Len()-17]
+	err = AESStreamDecryption(key, bytes.NewReader(truncated), &bytes.Buffer{})
+	if err == nil {
+		t.Error("truncated stream should be rejected")
+	}
+	chunk := AESStreamChunkSize + 16
+	truncated = sealed.Bytes()[:streamPrefixSize+chunk]
+	err = AESStreamDecryption(key, bytes.NewReader(truncated), &bytes.Buffer{})
+	if err == nil {
+		t.Error("stream truncated at chunk boundary should be rejected")
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	data := make([]byte, 5*MerkleSegmentSize+100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	root := MerkleRoot(data)
+	segments := MerkleSegments(int64(len(data)))
+	for i := 0; i < segments; i++ {
+		proof, err := NewMerkleProof(data, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !proof.Verify(root, segments) {
+			t.Errorf("failed to verify proof of segment %d", i)
+		}
+		proof.Segment = append([]byte{}, proof.Segment...)
+		proof.Segment[0] ^= 1
+		if proof.Verify(root, segments) {
+			t.Errorf("modified segment %d should be rejected", i)
+		}
+	}
+}
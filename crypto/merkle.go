@@ -0,0 +1,131 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"bytes"
+	"errors"
+)
+
+// MerkleSegmentSize is the size of data in each leaf of Merkle tree.
+const MerkleSegmentSize = 1024
+
+// MerkleProof proves the segment of data belongs to the Merkle root.
+// Siblings are the hashes from the leaf to the root, the promoted nodes have no sibling.
+type MerkleProof struct {
+	Index    int
+	Segment  []byte
+	Siblings []string
+}
+
+// Leaves and nodes are hashed with different prefix, so that a node can't be proved as a leaf.
+func merkleLeaf(segment []byte) []byte {
+	return SHA256BytesFromBytes(bytes.Join([][]byte{{0}, segment}, []byte{}))
+}
+
+func merkleNode(left, right []byte) []byte {
+	return SHA256BytesFromBytes(bytes.Join([][]byte{{1}, left, right}, []byte{}))
+}
+
+// MerkleSegments returns the count of segments of data with the size.
+func MerkleSegments(size int64) int {
+	if size <= 0 {
+		return 1
+	}
+	return int((size + MerkleSegmentSize - 1) / MerkleSegmentSize)
+}
+
+func merkleLevels(data []byte) [][][]byte {
+	segments := MerkleSegments(int64(len(data)))
+	level := make([][]byte, segments)
+	for i := range level {
+		end := (i + 1) * MerkleSegmentSize
+		if end > len(data) {
+			end = len(data)
+		}
+		level[i] = merkleLeaf(data[i*MerkleSegmentSize : end])
+	}
+	levels := [][][]byte{level}
+	for len(level) > 1 {
+		next := make([][]byte, (len(level)+1)/2)
+		for i := range next {
+			if 2*i+1 < len(level) {
+				next[i] = merkleNode(level[2*i], level[2*i+1])
+			} else {
+				next[i] = level[2*i]
+			}
+		}
+		levels = append(levels, next)
+		level = next
+	}
+	return levels
+}
+
+// MerkleRoot returns the hex of Merkle root of data.
+func MerkleRoot(data []byte) string {
+	levels := merkleLevels(data)
+	return BytesToHex(levels[len(levels)-1][0])
+}
+
+// NewMerkleProof generate the proof of the segment with index in data.
+func NewMerkleProof(data []byte, index int) (*MerkleProof, error) {
+	if index < 0 || index >= MerkleSegments(int64(len(data))) {
+		return nil, errors.New("invalid index of segment")
+	}
+	end := (index + 1) * MerkleSegmentSize
+	if end > len(data) {
+		end = len(data)
+	}
+	proof := &MerkleProof{
+		Index:    index,
+		Segment:  data[index*MerkleSegmentSize : end],
+		Siblings: make([]string, 0),
+	}
+	levels := merkleLevels(data)
+	for _, level := range levels[:len(levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof.Siblings = append(proof.Siblings, BytesToHex(level[sibling]))
+		}
+		index /= 2
+	}
+	return proof, nil
+}
+
+// Verify check the proof whether valid for the Merkle root of data with the count of segments.
+func (mp MerkleProof) Verify(root string, segments int) bool {
+	if mp.Index < 0 || mp.Index >= segments || len(mp.Segment) > MerkleSegmentSize {
+		return false
+	}
+	hash := merkleLeaf(mp.Segment)
+	index := mp.Index
+	siblings := mp.Siblings
+	for n := segments; n > 1; n = (n + 1) / 2 {
+		if index%2 == 1 || index+1 < n {
+			if len(siblings) == 0 {
+				return false
+			}
+			sibling := HexToBytes(siblings[0])
+			siblings = siblings[1:]
+			if index%2 == 1 {
+				hash = merkleNode(sibling, hash)
+			} else {
+				hash = merkleNode(hash, sibling)
+			}
+		}
+		index /= 2
+	}
+	return len(siblings) == 0 && BytesToHex(hash) == root
+}
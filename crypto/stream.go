@@ -0,0 +1,161 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// AESStreamChunkSize is the size of plaintext sealed in each chunk of the stream.
+const AESStreamChunkSize = 64 * 1024
+
+// The nonce of each chunk is composed of random prefix, chunk counter and last chunk flag,
+// so that the chunks can't be reordered, duplicated or truncated.
+const (
+	streamPrefixSize = 7
+	streamLastChunk  = 1
+)
+
+func streamNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, streamPrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamPrefixSize:], counter)
+	if last {
+		nonce[streamPrefixSize+4] = streamLastChunk
+	}
+	return nonce
+}
+
+// AESStreamSize returns the size of data encrypted by AESStreamEncryption from the plaintext with the size.
+func AESStreamSize(size int64) int64 {
+	chunks := (size + AESStreamChunkSize - 1) / AESStreamChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return streamPrefixSize + size + chunks*16
+}
+
+// AESStreamEncryption encrypt the data read from src by AES-GCM in chunks and write it into dst.
+// The output is the random nonce prefix followed by the sealed chunks.
+func AESStreamEncryption(key string, src io.Reader, dst io.Writer) error {
+	prefix := make([]byte, streamPrefixSize)
+	_, err := rand.Read(prefix)
+	if err != nil {
+		return err
+	}
+	return aesStreamEncryption(key, prefix, src, dst)
+}
+
+// AESConvergentEncryption encrypt the data as AESStreamEncryption, but the nonce prefix is derived from the key and the data,
+// so that the same data encrypted by the same key has the same output and can be deduplicated.
+// It reveals whether the outputs are encrypted from the same data, the output can be decrypted by AESStreamDecryption.
+func AESConvergentEncryption(key string, data []byte, dst io.Writer) error {
+	mac := hmac.New(sha256.New, HexToBytes(key))
+	mac.Write(data)
+	return aesStreamEncryption(key, mac.Sum(nil)[:streamPrefixSize], bytes.NewReader(data), dst)
+}
+
+func aesStreamEncryption(key string, prefix []byte, src io.Reader, dst io.Writer) error {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(prefix)
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(src)
+	buf := make([]byte, AESStreamChunkSize)
+	sealed := make([]byte, 0, AESStreamChunkSize+aead.Overhead())
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(reader, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last := err != nil
+		if !last {
+			_, err = reader.Peek(1)
+			if err != nil && err != io.EOF {
+				return err
+			}
+			last = err == io.EOF
+		}
+		if !last && counter == math.MaxUint32 {
+			return errors.New("stream too long")
+		}
+		sealed = aead.Seal(sealed[:0], streamNonce(prefix, counter, last), buf[:n], nil)
+		_, err = dst.Write(sealed)
+		if err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// AESStreamDecryption decrypt the data encrypted by AESStreamEncryption from src and write it into dst.
+// If any chunk is modified, reordered or the stream is truncated, it returns the error.
+// The chunks before the invalid one have been written into dst.
+func AESStreamDecryption(key string, src io.Reader, dst io.Writer) error {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(src)
+	prefix := make([]byte, streamPrefixSize)
+	_, err = io.ReadFull(reader, prefix)
+	if err != nil {
+		return errors.New("invalid stream header")
+	}
+	buf := make([]byte, AESStreamChunkSize+aead.Overhead())
+	plain := make([]byte, 0, AESStreamChunkSize)
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(reader, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last := err != nil
+		if !last {
+			_, err = reader.Peek(1)
+			if err != nil && err != io.EOF {
+				return err
+			}
+			last = err == io.EOF
+		}
+		plain, err = aead.Open(plain[:0], streamNonce(prefix, counter, last), buf[:n], nil)
+		if err != nil {
+			return err
+		}
+		_, err = dst.Write(plain)
+		if err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		if counter == math.MaxUint32 {
+			return errors.New("stream too long")
+		}
+	}
+}
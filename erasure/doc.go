@@ -0,0 +1,2 @@
+// Package erasure provides Reed-Solomon erasure coding of fragments.
+package erasure
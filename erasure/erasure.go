@@ -0,0 +1,250 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package erasure
+
+import (
+	"errors"
+	"io"
+)
+
+// MaxShards is the maximum count of data and parity shards.
+const MaxShards = 256
+
+// Encoder encode data shards into parity shards and reconstruct the missing shards.
+// The coding is systematic, the data shards are stored as they are.
+type Encoder struct {
+	DataShards   int
+	ParityShards int
+	matrix       matrix
+}
+
+// New is the construct for Encoder.
+func New(dataShards, parityShards int) (*Encoder, error) {
+	if dataShards <= 0 || parityShards < 0 {
+		return nil, errors.New("invalid count of shards")
+	}
+	if dataShards+parityShards > MaxShards {
+		return nil, errors.New("too many shards")
+	}
+	v := vandermonde(dataShards+parityShards, dataShards)
+	top, err := v[:dataShards].invert()
+	if err != nil {
+		return nil, err
+	}
+	return &Encoder{
+		DataShards:   dataShards,
+		ParityShards: parityShards,
+		matrix:       v.multiply(top),
+	}, nil
+}
+
+// Total returns the count of data and parity shards.
+func (e *Encoder) Total() int {
+	return e.DataShards + e.ParityShards
+}
+
+// Check the shards whether valid, returns the size of shard.
+func (e *Encoder) checkShards(shards [][]byte, allowMissing bool) (int, error) {
+	if len(shards) != e.Total() {
+		return 0, errors.New("invalid count of shards")
+	}
+	size := -1
+	for _, shard := range shards {
+		if shard == nil {
+			if !allowMissing {
+				return 0, errors.New("shard is missing")
+			}
+			continue
+		}
+		if size == -1 {
+			size = len(shard)
+		} else if size != len(shard) {
+			return 0, errors.New("shards have different size")
+		}
+	}
+	if size == -1 {
+		return 0, errors.New("all shards are missing")
+	}
+	return size, nil
+}
+
+// Compute the output shards by multiplying the rows of matrix with the input shards.
+func codeShards(rows matrix, inputs, outputs [][]byte) {
+	for i, row := range rows {
+		output := outputs[i]
+		for j := range output {
+			output[j] = 0
+		}
+		for c, input := range inputs {
+			coefficient := row[c]
+			if coefficient == 0 {
+				continue
+			}
+			for j, b := range input {
+				output[j] ^= galMul(coefficient, b)
+			}
+		}
+	}
+}
+
+// Encode compute the parity shards from the data shards.
+// The shards should contain data shards followed by parity shards, all with the same size.
+func (e *Encoder) Encode(shards [][]byte) error {
+	size, err := e.checkShards(shards, true)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < e.DataShards; i++ {
+		if shards[i] == nil {
+			return errors.New("data shard is missing")
+		}
+	}
+	for i := e.DataShards; i < e.Total(); i++ {
+		if shards[i] == nil {
+			shards[i] = make([]byte, size)
+		}
+	}
+	codeShards(e.matrix[e.DataShards:], shards[:e.DataShards], shards[e.DataShards:])
+	return nil
+}
+
+// Verify returns whether the parity shards match the data shards.
+func (e *Encoder) Verify(shards [][]byte) (bool, error) {
+	size, err := e.checkShards(shards, false)
+	if err != nil {
+		return false, err
+	}
+	parity := make([][]byte, e.ParityShards)
+	for i := range parity {
+		parity[i] = make([]byte, size)
+	}
+	codeShards(e.matrix[e.DataShards:], shards[:e.DataShards], parity)
+	for i, shard := range parity {
+		for j := range shard {
+			if shard[j] != shards[e.DataShards+i][j] {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// Reconstruct rebuild the missing shards, which are nil in the shards.
+// It requires at least DataShards shards present.
+func (e *Encoder) Reconstruct(shards [][]byte) error {
+	size, err := e.checkShards(shards, true)
+	if err != nil {
+		return err
+	}
+	rows := make(matrix, 0, e.DataShards)
+	inputs := make([][]byte, 0, e.DataShards)
+	for i, shard := range shards {
+		if shard != nil && len(rows) < e.DataShards {
+			rows = append(rows, e.matrix[i])
+			inputs = append(inputs, shard)
+		}
+	}
+	if len(rows) < e.DataShards {
+		return errors.New("too few shards to reconstruct")
+	}
+	decode, err := rows.invert()
+	if err != nil {
+		return err
+	}
+	missingRows := make(matrix, 0)
+	outputs := make([][]byte, 0)
+	for i := 0; i < e.DataShards; i++ {
+		if shards[i] == nil {
+			shards[i] = make([]byte, size)
+			missingRows = append(missingRows, decode[i])
+			outputs = append(outputs, shards[i])
+		}
+	}
+	codeShards(missingRows, inputs, outputs)
+	missingRows = missingRows[:0]
+	outputs = outputs[:0]
+	for i := e.DataShards; i < e.Total(); i++ {
+		if shards[i] == nil {
+			shards[i] = make([]byte, size)
+			missingRows = append(missingRows, e.matrix[i])
+			outputs = append(outputs, shards[i])
+		}
+	}
+	codeShards(missingRows, shards[:e.DataShards], outputs)
+	return nil
+}
+
+// Split the data into data shards with the same size and allocate the parity shards.
+// The last data shard is padded with zero.
+func (e *Encoder) Split(data []byte) [][]byte {
+	size := (len(data) + e.DataShards - 1) / e.DataShards
+	if size == 0 {
+		size = 1
+	}
+	padded := make([]byte, size*e.Total())
+	copy(padded, data)
+	shards := make([][]byte, e.Total())
+	for i := range shards {
+		shards[i] = padded[i*size : (i+1)*size]
+	}
+	return shards
+}
+
+// Join write the data of data shards into dst, without the padding.
+func (e *Encoder) Join(dst io.Writer, shards [][]byte, size int64) error {
+	if len(shards) < e.DataShards {
+		return errors.New("too few shards")
+	}
+	for _, shard := range shards[:e.DataShards] {
+		if shard == nil {
+			return errors.New("data shard is missing")
+		}
+		if int64(len(shard)) > size {
+			shard = shard[:size]
+		}
+		n, err := dst.Write(shard)
+		if err != nil {
+			return err
+		}
+		size -= int64(n)
+		if size == 0 {
+			return nil
+		}
+	}
+	if size > 0 {
+		return errors.New("shards are too small")
+	}
+	return nil
+}
+
+// Place assign each shard to a distinct sea in order.
+// The duplicate seas are skipped, it returns the error when there are not enough distinct seas.
+func Place(shards int, seas []string) ([]string, error) {
+	placement := make([]string, 0, shards)
+	used := make(map[string]bool)
+	for _, s := range seas {
+		if len(placement) == shards {
+			break
+		}
+		if !used[s] {
+			used[s] = true
+			placement = append(placement, s)
+		}
+	}
+	if len(placement) < shards {
+		return nil, errors.New("not enough distinct seas for shards")
+	}
+	return placement, nil
+}
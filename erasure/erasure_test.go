@@ -0,0 +1,60 @@
+package erasure
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestEncoder_Reconstruct(t *testing.T) {
+	encoder, err := New(4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(data)
+	shards := encoder.Split(data)
+	err = encoder.Encode(shards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := encoder.Verify(shards)
+	if err != nil || !ok {
+		t.Fatal("failed to verify shards")
+	}
+	for i := 0; i < encoder.Total(); i++ {
+		for j := i + 1; j < encoder.Total(); j++ {
+			test := make([][]byte, len(shards))
+			copy(test, shards)
+			test[i], test[j] = nil, nil
+			err = encoder.Reconstruct(test)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			err = encoder.Join(&buf, test, int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), data) {
+				t.Errorf("failed to reconstruct without shard %d and %d", i, j)
+			}
+		}
+	}
+	shards[0], shards[1], shards[2] = nil, nil, nil
+	if encoder.Reconstruct(shards) == nil {
+		t.Error("reconstruct should fail with too few shards")
+	}
+}
+
+func TestPlace(t *testing.T) {
+	placement, err := Place(3, []string{"a", "b", "a", "c", "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(placement)
+	_, err = Place(3, []string{"a", "b", "a"})
+	if err == nil {
+		t.Error("placement should fail without enough distinct seas")
+	}
+}
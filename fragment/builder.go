@@ -0,0 +1,200 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fragment
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"errors"
+	"io"
+
+	"github.com/yellowssi/SeaStorage-TP/crypto"
+	"github.com/yellowssi/SeaStorage-TP/erasure"
+	"github.com/yellowssi/SeaStorage-TP/storage"
+)
+
+// StoreFunc receive the encrypted data of fragment in order.
+type StoreFunc func(fragment *storage.Fragment, data []byte) error
+
+// FetchFunc returns the encrypted data of fragment.
+type FetchFunc func(fragment *storage.Fragment) ([]byte, error)
+
+// Build split the data by chunker, encrypt each chunk by the key and hash it.
+// The encrypted fragments are passed to store in order.
+// The returned FileInfo holds the plaintext key, it should be wrapped by WrapKey before submitted.
+// The chunks are encrypted convergently, so that the same chunks encrypted by the same key are deduplicated.
+// The hash of file is SHA512 of the plaintext and the hash of fragment is SHA512 of the encrypted data.
+func Build(name string, c Chunker, key string, store StoreFunc) (*storage.FileInfo, error) {
+	var size int64
+	fileHash := sha512.New()
+	fragments := make([]*storage.Fragment, 0)
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		size += int64(len(chunk))
+		fileHash.Write(chunk)
+		var buf bytes.Buffer
+		err = crypto.AESConvergentEncryption(key, chunk, &buf)
+		if err != nil {
+			return nil, err
+		}
+		data := buf.Bytes()
+		fragment := &storage.Fragment{
+			Hash:       crypto.SHA512HexFromBytes(data),
+			Size:       int64(len(data)),
+			MerkleRoot: crypto.MerkleRoot(data),
+			Seas:       make([]*storage.FragmentSea, 0),
+		}
+		err = store(fragment, data)
+		if err != nil {
+			return nil, err
+		}
+		fragments = append(fragments, fragment)
+	}
+	return storage.NewFileInfo(name, size, crypto.BytesToHex(fileHash.Sum(nil)), key, fragments), nil
+}
+
+// Reassemble fetch the fragments of file in order, verify and decrypt them into dst.
+// It returns the error if the hash of any fragment or the file doesn't match.
+func Reassemble(info storage.FileInfo, fetch FetchFunc, dst io.Writer) error {
+	var size int64
+	fileHash := sha512.New()
+	for _, fragment := range info.Fragments {
+		data, err := fetch(fragment)
+		if err != nil {
+			return err
+		}
+		if crypto.SHA512HexFromBytes(data) != fragment.Hash {
+			return errors.New("invalid fragment: " + fragment.Hash)
+		}
+		var buf bytes.Buffer
+		err = crypto.AESStreamDecryption(info.Key, bytes.NewReader(data), &buf)
+		if err != nil {
+			return err
+		}
+		size += int64(buf.Len())
+		fileHash.Write(buf.Bytes())
+		_, err = dst.Write(buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+	if size != info.Size || crypto.BytesToHex(fileHash.Sum(nil)) != info.Hash {
+		return errors.New("invalid file: " + info.Name)
+	}
+	return nil
+}
+
+// BuildErasure encrypt the whole data by the key and split it into data shards and parity shards.
+// Each shard is a fragment passed to store in order, the file can be reassembled from any DataShards fragments.
+// The data is read into memory at once.
+func BuildErasure(name string, src io.Reader, key string, coding storage.Coding, store StoreFunc) (*storage.FileInfo, error) {
+	encoder, err := erasure.New(coding.DataShards, coding.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+	fileHash := sha512.New()
+	counter := &countWriter{}
+	var buf bytes.Buffer
+	err = crypto.AESStreamEncryption(key, io.TeeReader(src, io.MultiWriter(fileHash, counter)), &buf)
+	if err != nil {
+		return nil, err
+	}
+	shards := encoder.Split(buf.Bytes())
+	err = encoder.Encode(shards)
+	if err != nil {
+		return nil, err
+	}
+	fragments := make([]*storage.Fragment, len(shards))
+	for i, shard := range shards {
+		fragments[i] = &storage.Fragment{
+			Hash:       crypto.SHA512HexFromBytes(shard),
+			Size:       int64(len(shard)),
+			MerkleRoot: crypto.MerkleRoot(shard),
+			Seas:       make([]*storage.FragmentSea, 0),
+		}
+		err = store(fragments[i], shard)
+		if err != nil {
+			return nil, err
+		}
+	}
+	info := storage.NewFileInfo(name, counter.n, crypto.BytesToHex(fileHash.Sum(nil)), key, fragments)
+	info.Coding = coding
+	return info, nil
+}
+
+// ReassembleErasure fetch the fragments of erasure coded file, reconstruct the missing ones and decrypt it into dst.
+// The fragments failed to fetch or verify are treated as missing.
+func ReassembleErasure(info storage.FileInfo, fetch FetchFunc, dst io.Writer) error {
+	if !info.Coding.Erasure() {
+		return errors.New("file isn't erasure coded: " + info.Name)
+	}
+	encoder, err := erasure.New(info.Coding.DataShards, info.Coding.ParityShards)
+	if err != nil {
+		return err
+	}
+	if len(info.Fragments) != encoder.Total() {
+		return errors.New("invalid count of fragments: " + info.Name)
+	}
+	shards := make([][]byte, encoder.Total())
+	present := 0
+	for i, fragment := range info.Fragments {
+		if present == encoder.DataShards {
+			break
+		}
+		data, err := fetch(fragment)
+		if err != nil || crypto.SHA512HexFromBytes(data) != fragment.Hash {
+			continue
+		}
+		shards[i] = data
+		present++
+	}
+	if present < encoder.DataShards {
+		return errors.New("too few fragments to reconstruct: " + info.Name)
+	}
+	err = encoder.Reconstruct(shards)
+	if err != nil {
+		return err
+	}
+	var sealed bytes.Buffer
+	err = encoder.Join(&sealed, shards, crypto.AESStreamSize(info.Size))
+	if err != nil {
+		return err
+	}
+	fileHash := sha512.New()
+	var buf bytes.Buffer
+	err = crypto.AESStreamDecryption(info.Key, &sealed, io.MultiWriter(&buf, fileHash))
+	if err != nil {
+		return err
+	}
+	if int64(buf.Len()) != info.Size || crypto.BytesToHex(fileHash.Sum(nil)) != info.Hash {
+		return errors.New("invalid file: " + info.Name)
+	}
+	_, err = dst.Write(buf.Bytes())
+	return err
+}
+
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
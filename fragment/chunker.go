@@ -0,0 +1,163 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fragment
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+
+	"github.com/yellowssi/SeaStorage-TP/crypto"
+)
+
+// Default sizes of chunks.
+const (
+	DefaultChunkSize    = 4 * 1024 * 1024
+	DefaultMinChunkSize = 1024 * 1024
+	DefaultAvgChunkSize = 4 * 1024 * 1024
+	DefaultMaxChunkSize = 16 * 1024 * 1024
+)
+
+// Chunker split the data into chunks.
+type Chunker interface {
+	// Next returns the next chunk of data.
+	// When there is no more data, it returns io.EOF.
+	Next() ([]byte, error)
+}
+
+// FixedChunker split the data into chunks with the same size.
+// The last chunk may be smaller.
+type FixedChunker struct {
+	reader io.Reader
+	size   int
+}
+
+// NewFixedChunker is the construct for FixedChunker.
+func NewFixedChunker(r io.Reader, size int) (*FixedChunker, error) {
+	if size <= 0 {
+		return nil, errors.New("invalid chunk size")
+	}
+	return &FixedChunker{reader: r, size: size}, nil
+}
+
+// Next returns the next chunk of data.
+func (c *FixedChunker) Next() ([]byte, error) {
+	buf := make([]byte, c.size)
+	n, err := io.ReadFull(c.reader, buf)
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// The gear table of content-defined chunking.
+// Each value is the first 8 bytes of SHA256 of the byte, so that all clients cut the same boundaries.
+var gear [256]uint64
+
+func init() {
+	for i := range gear {
+		gear[i] = binary.BigEndian.Uint64(crypto.SHA256BytesFromBytes([]byte{byte(i)}))
+	}
+}
+
+// CDCChunker split the data into chunks by content (FastCDC).
+// The same content produces the same boundaries, even if data is inserted before it.
+type CDCChunker struct {
+	reader io.Reader
+	min    int
+	avg    int
+	max    int
+	maskS  uint64
+	maskL  uint64
+	buf    []byte
+	eof    bool
+}
+
+// NewCDCChunker is the construct for CDCChunker.
+// The average size should be the power of 2 and min <= avg <= max.
+func NewCDCChunker(r io.Reader, min, avg, max int) (*CDCChunker, error) {
+	if min <= 0 || min > avg || avg > max {
+		return nil, errors.New("invalid chunk size")
+	}
+	if avg&(avg-1) != 0 || avg < 64 {
+		return nil, errors.New("average chunk size should be the power of 2 and not less than 64")
+	}
+	n := uint(bits.TrailingZeros(uint(avg)))
+	return &CDCChunker{
+		reader: r,
+		min:    min,
+		avg:    avg,
+		max:    max,
+		maskS:  ((1 << (n + 1)) - 1) << (64 - n - 1),
+		maskL:  ((1 << (n - 1)) - 1) << (64 - n + 1),
+		buf:    make([]byte, 0, max),
+	}, nil
+}
+
+// Next returns the next chunk of data.
+func (c *CDCChunker) Next() ([]byte, error) {
+	if !c.eof && len(c.buf) < c.max {
+		n, err := io.ReadFull(c.reader, c.buf[len(c.buf):c.max])
+		c.buf = c.buf[:len(c.buf)+n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if len(c.buf) == 0 {
+		return nil, io.EOF
+	}
+	n := c.cut(c.buf)
+	chunk := make([]byte, n)
+	copy(chunk, c.buf)
+	c.buf = c.buf[:copy(c.buf, c.buf[n:])]
+	return chunk, nil
+}
+
+// Find the boundary of chunk in the data.
+// Before the average size, the harder mask is used to make chunk size normalized.
+func (c *CDCChunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.min {
+		return n
+	}
+	if n > c.max {
+		n = c.max
+	}
+	normal := c.avg
+	if normal > n {
+		normal = n
+	}
+	var fp uint64
+	i := c.min
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
@@ -0,0 +1,2 @@
+// Package fragment provides splitting files into encrypted fragments and reassembling them.
+package fragment
@@ -0,0 +1,150 @@
+package fragment
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/yellowssi/SeaStorage-TP/crypto"
+	"github.com/yellowssi/SeaStorage-TP/storage"
+)
+
+var testData = make([]byte, 300*1024)
+
+func init() {
+	rand.New(rand.NewSource(1)).Read(testData)
+}
+
+func buildAndReassemble(t *testing.T, c Chunker) {
+	key := crypto.NewAESKey(256)
+	blobs := make(map[string][]byte)
+	info, err := Build("test", c, key, func(fragment *storage.Fragment, data []byte) error {
+		blobs[fragment.Hash] = data
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(len(info.Fragments))
+	var buf bytes.Buffer
+	fetch := func(fragment *storage.Fragment) ([]byte, error) {
+		data, ok := blobs[fragment.Hash]
+		if !ok {
+			return nil, errors.New("fragment doesn't exists")
+		}
+		return data, nil
+	}
+	err = Reassemble(*info, fetch, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), testData) {
+		t.Error("reassembled data doesn't match")
+	}
+	blobs[info.Fragments[0].Hash][20] ^= 1
+	err = Reassemble(*info, fetch, &bytes.Buffer{})
+	if err == nil {
+		t.Error("modified fragment should be rejected")
+	}
+}
+
+func TestFixedChunker(t *testing.T) {
+	c, err := NewFixedChunker(bytes.NewReader(testData), 64*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buildAndReassemble(t, c)
+	if _, err = NewFixedChunker(bytes.NewReader(testData), 0); err == nil {
+		t.Error("chunk size should be positive")
+	}
+}
+
+func TestCDCChunker(t *testing.T) {
+	c, err := NewCDCChunker(bytes.NewReader(testData), 8*1024, 32*1024, 128*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buildAndReassemble(t, c)
+}
+
+func TestCDCChunker_Boundaries(t *testing.T) {
+	chunks := func(data []byte) map[string]bool {
+		c, _ := NewCDCChunker(bytes.NewReader(data), 2*1024, 8*1024, 32*1024)
+		hashes := make(map[string]bool)
+		for {
+			chunk, err := c.Next()
+			if err != nil {
+				break
+			}
+			hashes[crypto.SHA256HexFromBytes(chunk)] = true
+		}
+		return hashes
+	}
+	origin := chunks(testData)
+	shifted := chunks(append([]byte("inserted"), testData...))
+	same := 0
+	for hash := range shifted {
+		if origin[hash] {
+			same++
+		}
+	}
+	if same < len(origin)/2 {
+		t.Errorf("chunks should be kept after insertion: %d/%d", same, len(origin))
+	}
+}
+
+func TestBuild_Dedup(t *testing.T) {
+	key := crypto.NewAESKey(256)
+	build := func(data []byte) map[string]bool {
+		c, _ := NewCDCChunker(bytes.NewReader(data), 2*1024, 8*1024, 32*1024)
+		hashes := make(map[string]bool)
+		_, err := Build("test", c, key, func(fragment *storage.Fragment, data []byte) error {
+			hashes[fragment.Hash] = true
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hashes
+	}
+	origin := build(testData)
+	shifted := build(append([]byte("inserted"), testData...))
+	same := 0
+	for hash := range shifted {
+		if origin[hash] {
+			same++
+		}
+	}
+	if same < len(origin)/2 {
+		t.Errorf("fragments should be deduplicated after insertion: %d/%d", same, len(origin))
+	}
+}
+
+func TestBuildErasure(t *testing.T) {
+	key := crypto.NewAESKey(256)
+	blobs := make(map[string][]byte)
+	info, err := BuildErasure("test", bytes.NewReader(testData), key, storage.Coding{DataShards: 4, ParityShards: 2}, func(fragment *storage.Fragment, data []byte) error {
+		blobs[fragment.Hash] = data
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(blobs, info.Fragments[0].Hash)
+	blobs[info.Fragments[3].Hash][0] ^= 1
+	var buf bytes.Buffer
+	err = ReassembleErasure(*info, func(fragment *storage.Fragment) ([]byte, error) {
+		data, ok := blobs[fragment.Hash]
+		if !ok {
+			return nil, errors.New("fragment doesn't exists")
+		}
+		return data, nil
+	}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), testData) {
+		t.Error("reassembled data doesn't match")
+	}
+}
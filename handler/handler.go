@@ -21,6 +21,7 @@ import (
 	"github.com/hyperledger/sawtooth-sdk-go/protobuf/processor_pb2"
 	"github.com/yellowssi/SeaStorage-TP/payload"
 	"github.com/yellowssi/SeaStorage-TP/state"
+	"strconv"
 )
 
 var logger = logging.Get()
@@ -68,12 +69,12 @@ func (h *SeaStorageHandler) Apply(request *processor_pb2.TpProcessRequest, conte
 		if len(pl.Target) != 1 || pl.Target[0] == "" {
 			return &processor.InvalidTransactionError{Msg: "group name is nil"}
 		}
-		return st.CreateGroup(pl.Target[0], state.MakeAddress(state.AddressTypeUser, pl.Name, user), pl.Key)
+		return st.CreateGroup(pl.Target[0], pl.Name, user, pl.Key)
 	case payload.CreateSea:
 		if len(pl.Target) != 1 || pl.Target[0] == "" {
 			return &processor.InvalidTransactionError{Msg: "sea name is nil"}
 		}
-		return st.CreateSea(pl.Target[0], user)
+		return st.CreateSea(pl.Target[0], user, pl.SeaInfo)
 
 	// User Action
 	case payload.UserCreateDirectory:
@@ -100,10 +101,14 @@ func (h *SeaStorageHandler) Apply(request *processor_pb2.TpProcessRequest, conte
 	case payload.UserUpdateFileKey:
 		return st.UserUpdateFileKey(pl.Name, user, pl.PWD, pl.FileInfo)
 	case payload.UserPublishKey:
-		if len(pl.Target) != 1 || pl.Target[0] == "" {
+		if len(pl.Target) < 1 || len(pl.Target) > 2 || pl.Target[0] == "" {
 			return &processor.InvalidTransactionError{Msg: "the index of key is nil"}
 		}
-		return st.UserPublishKey(pl.Name, user, pl.Target[0], pl.Key)
+		var recipient string
+		if len(pl.Target) == 2 {
+			recipient = pl.Target[1]
+		}
+		return st.UserPublishKey(pl.Name, user, pl.Target[0], recipient, pl.Key)
 	case payload.UserMove:
 		if len(pl.Target) != 2 || pl.Target[0] == "" || pl.Target[1] == "" {
 			return &processor.InvalidTransactionError{Msg: "the name of file or directory is nil"}
@@ -125,15 +130,134 @@ func (h *SeaStorageHandler) Apply(request *processor_pb2.TpProcessRequest, conte
 	//case payload.GroupUpdateFileData:
 	//case payload.GroupUpdateFileKey:
 	//case payload.GroupPublishKey:
+	case payload.GroupAddMember:
+		if len(pl.Target) != 2 || pl.Target[0] == "" || pl.Target[1] == "" {
+			return &processor.InvalidTransactionError{Msg: "group name or member address is nil"}
+		}
+		return st.GroupAddMember(pl.Target[0], pl.Name, user, pl.Target[1], pl.Key)
+	case payload.GroupRemoveMember:
+		if len(pl.Target) != 2 || pl.Target[0] == "" || pl.Target[1] == "" {
+			return &processor.InvalidTransactionError{Msg: "group name or member address is nil"}
+		}
+		return st.GroupRemoveMember(pl.Target[0], pl.Name, user, pl.Target[1], pl.WrappedKeys, pl.FileKeys)
 	// TODO: Invite User & Access User Join Group & Leave Member
 
 	// Sea Action
 	case payload.SeaStoreFile:
-		return st.SeaStoreFile(pl.Name, user, pl.UserOperations)
+		return st.SeaStoreFile(pl.Name, user, pl.UserOperations, pl.MerkleRoots)
 	case payload.SeaConfirmOperations:
-		return st.SeaConfirmOperations(pl.Name, user, pl.SeaOperations)
+		return st.SeaConfirmOperations(pl.Name, user, pl.OperationRanges)
+	case payload.SeaUpdateInfo:
+		return st.SeaUpdateInfo(pl.Name, user, pl.SeaInfo)
+	case payload.SeaHeartbeat:
+		return st.SeaHeartbeat(pl.Name, user)
+	case payload.SeaDecommission:
+		return st.SeaDecommission(pl.Name, user)
+
+	// Share Link Action
+	case payload.UserCreateShareLink:
+		if len(pl.Target) != 1 || pl.Target[0] == "" {
+			return &processor.InvalidTransactionError{Msg: "filename is nil"}
+		}
+		return st.UserCreateShareLink(pl.Name, user, pl.PWD, pl.Target[0], pl.ShareLinkInfo)
+	case payload.UserRevokeShareLink:
+		if len(pl.Target) != 1 || pl.Target[0] == "" {
+			return &processor.InvalidTransactionError{Msg: "the public key of share link is nil"}
+		}
+		return st.UserRevokeShareLink(pl.Name, user, pl.Target[0])
+	case payload.ResolveShareLink:
+		return st.ResolveShareLink(user)
+
+	// Challenge Action
+	case payload.UserChallengeSea:
+		if len(pl.Target) != 3 || pl.Target[0] == "" || pl.Target[1] == "" || pl.Target[2] == "" {
+			return &processor.InvalidTransactionError{Msg: "the filename, fragment hash or sea address is nil"}
+		}
+		return st.UserChallengeSea(pl.Name, user, pl.PWD, pl.Target[0], pl.Target[1], pl.Target[2], request.GetSignature())
+	case payload.SeaRespondChallenge:
+		if len(pl.Target) != 1 || pl.Target[0] == "" {
+			return &processor.InvalidTransactionError{Msg: "the id of challenge is nil"}
+		}
+		return st.SeaRespondChallenge(pl.Name, user, pl.Target[0], pl.Proofs)
+
+	// Repair Action
+	case payload.CreateRepairTasks:
+		if len(pl.Target) != 2 || pl.Target[0] == "" {
+			return &processor.InvalidTransactionError{Msg: "sea address is nil"}
+		}
+		page, err := strconv.ParseUint(pl.Target[1], 10, 64)
+		if err != nil {
+			return &processor.InvalidTransactionError{Msg: "invalid page of stored fragments: " + pl.Target[1]}
+		}
+		return st.CreateRepairTasks(pl.Target[0], page)
+	case payload.SeaClaimRepair:
+		id, err := parseTaskID(pl.Target)
+		if err != nil {
+			return err
+		}
+		return st.SeaClaimRepair(pl.Name, user, id)
+	case payload.SeaCompleteRepair:
+		id, err := parseTaskID(pl.Target)
+		if err != nil {
+			return err
+		}
+		if len(pl.MerkleRoots) != 1 {
+			return &processor.InvalidTransactionError{Msg: "merkle root of fragment is required"}
+		}
+		return st.SeaCompleteRepair(pl.Name, user, id, pl.MerkleRoots[0])
+
+	// Payment Action
+	case payload.TreasuryDeposit:
+		if len(pl.Target) != 1 || pl.Target[0] == "" {
+			return &processor.InvalidTransactionError{Msg: "user address is nil"}
+		}
+		return st.TreasuryDeposit(user, pl.Target[0], pl.Amount)
+	case payload.SeaSettle:
+		if len(pl.Target) != 1 || pl.Target[0] == "" {
+			return &processor.InvalidTransactionError{Msg: "owner address is nil"}
+		}
+		return st.SeaSettle(pl.Name, user, pl.Target[0])
+
+	// Retention Action
+	case payload.UserRenewFile:
+		if len(pl.Target) != 1 || pl.Target[0] == "" {
+			return &processor.InvalidTransactionError{Msg: "filename is nil"}
+		}
+		return st.UserRenewFile(pl.Name, user, pl.PWD, pl.Target[0], pl.Retention)
+	case payload.SweepExpired:
+		if len(pl.Target) != 1 || pl.Target[0] == "" {
+			return &processor.InvalidTransactionError{Msg: "user address is nil"}
+		}
+		return st.SweepExpired(pl.Target[0])
+
+	// Key Action
+	case payload.UserRotateKeys:
+		return st.UserRotateKeys(pl.Name, user, pl.PWD, pl.KeyRotations)
+
+	// Device Action
+	case payload.UserAddDevice:
+		if len(pl.Target) != 1 || pl.Target[0] == "" {
+			return &processor.InvalidTransactionError{Msg: "public key of device is nil"}
+		}
+		return st.UserAddDevice(pl.Name, user, pl.Target[0])
+	case payload.UserRemoveDevice:
+		if len(pl.Target) != 1 || pl.Target[0] == "" {
+			return &processor.InvalidTransactionError{Msg: "public key of device is nil"}
+		}
+		return st.UserRemoveDevice(pl.Name, user, pl.Target[0])
 
 	default:
 		return &processor.InvalidTransactionError{Msg: fmt.Sprint("Invalid Action: ", pl.Action)}
 	}
 }
+
+func parseTaskID(target []string) (uint64, error) {
+	if len(target) != 1 || target[0] == "" {
+		return 0, &processor.InvalidTransactionError{Msg: "the id of task is nil"}
+	}
+	id, err := strconv.ParseUint(target[0], 10, 64)
+	if err != nil {
+		return 0, &processor.InvalidTransactionError{Msg: "invalid id of task: " + target[0]}
+	}
+	return id, nil
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/gob"
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/sawtooth-sdk-go/processor"
+	"github.com/yellowssi/SeaStorage-TP/crypto"
 	"github.com/yellowssi/SeaStorage-TP/sea"
 	"github.com/yellowssi/SeaStorage-TP/storage"
 	"github.com/yellowssi/SeaStorage-TP/user"
@@ -58,35 +59,92 @@ var (
 	GroupUpdateFileData  uint = 25
 	GroupUpdateFileKey   uint = 26
 	GroupPublishKey      uint = 27
+	GroupAddMember       uint = 28
+	GroupRemoveMember    uint = 29
 )
 
 // Sea Action
 var (
 	SeaStoreFile         uint = 30
 	SeaConfirmOperations uint = 31
+	SeaUpdateInfo        uint = 32
+	SeaHeartbeat         uint = 33
+	SeaDecommission      uint = 34
+)
+
+// Share Link Action
+var (
+	UserCreateShareLink uint = 40
+	UserRevokeShareLink uint = 41
+	ResolveShareLink    uint = 42
+)
+
+// Challenge Action
+var (
+	UserChallengeSea    uint = 50
+	SeaRespondChallenge uint = 51
+)
+
+// Repair Action
+var (
+	CreateRepairTasks uint = 60
+	SeaClaimRepair    uint = 61
+	SeaCompleteRepair uint = 62
+)
+
+// Payment Action
+var (
+	TreasuryDeposit uint = 70
+	SeaSettle       uint = 71
+)
+
+// Retention Action
+var (
+	UserRenewFile uint = 80
+	SweepExpired  uint = 81
+)
+
+// Key Action
+var (
+	UserRotateKeys uint = 90
+)
+
+// Device Action
+var (
+	UserAddDevice    uint = 100
+	UserRemoveDevice uint = 101
 )
 
 type SeaStoragePayload struct {
-	Action         uint             `default:"Unset(0)"`
-	Name           string           `default:""`
-	PWD            string           `default:"/"`
-	Target         []string         `default:"nil"`
-	Key            string           `default:""`
-	FileInfo       storage.FileInfo `default:"FileInfo{}"`
-	UserOperations []user.Operation `default:"nil"`
-	SeaOperations  []sea.Operation  `default:"nil"`
+	Action          uint                  `default:"Unset(0)"`
+	Name            string                `default:""`
+	PWD             string                `default:"/"`
+	Target          []string              `default:"nil"`
+	Key             string                `default:""`
+	FileInfo        storage.FileInfo      `default:"FileInfo{}"`
+	UserOperations  []user.Operation      `default:"nil"`
+	OperationRanges []sea.OperationRange  `default:"nil"`
+	ShareLinkInfo   storage.ShareLinkInfo `default:"ShareLinkInfo{}"`
+	Proofs          []crypto.MerkleProof  `default:"nil"`
+	SeaInfo         sea.SeaInfo           `default:"SeaInfo{}"`
+	Amount          int64                 `default:"0"`
+	Retention       int64                 `default:"0"`
+	KeyRotations    []storage.KeyRotation `default:"nil"`
+	WrappedKeys     map[string]string     `default:"nil"`
+	FileKeys        map[string]string     `default:"nil"`
+	MerkleRoots     []string              `default:"nil"` // confirmed by the sea in the order of UserOperations, or of the repaired fragment
 }
 
-func NewSeaStoragePayload(action uint, name string, PWD string, target []string, key string, fileInfo storage.FileInfo, userOperations []user.Operation, seaOperations []sea.Operation) *SeaStoragePayload {
+func NewSeaStoragePayload(action uint, name string, PWD string, target []string, key string, fileInfo storage.FileInfo, userOperations []user.Operation, operationRanges []sea.OperationRange) *SeaStoragePayload {
 	return &SeaStoragePayload{
-		Action:         action,
-		Name:           name,
-		PWD:            PWD,
-		Target:         target,
-		Key:            key,
-		FileInfo:       fileInfo,
-		UserOperations: userOperations,
-		SeaOperations:  seaOperations,
+		Action:          action,
+		Name:            name,
+		PWD:             PWD,
+		Target:          target,
+		Key:             key,
+		FileInfo:        fileInfo,
+		UserOperations:  userOperations,
+		OperationRanges: operationRanges,
 	}
 }
 
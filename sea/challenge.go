@@ -0,0 +1,148 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sea
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/yellowssi/SeaStorage-TP/crypto"
+)
+
+const (
+	// ChallengeSegments is the count of segments selected in each challenge.
+	ChallengeSegments = 3
+	// ChallengeTimeout is the duration for sea to respond the challenge.
+	ChallengeTimeout = time.Hour
+	// ChallengeCooldown is the minimum duration between the challenges of the same fragment stored in the sea.
+	ChallengeCooldown = 24 * time.Hour
+	// MaxOwnerChallenges is the maximum count of open challenges of each owner in the sea.
+	MaxOwnerChallenges = 8
+)
+
+// Challenge requires the sea to prove it still stores the fragment.
+// The sea should respond the Merkle proofs of the segments with Indexes before Deadline.
+type Challenge struct {
+	ID         string
+	Owner      string // owner address
+	Hash       string // the hash of fragment
+	MerkleRoot string
+	Segments   int
+	Indexes    []int
+	Deadline   int64
+}
+
+// NewChallenge generate the challenge of fragment.
+// The indexes of segments are selected by the seed, so that every validator selects the same ones.
+func NewChallenge(id, owner, hash, merkleRoot string, size int64, seed []byte, deadline time.Time) *Challenge {
+	segments := crypto.MerkleSegments(size)
+	count := ChallengeSegments
+	if count > segments {
+		count = segments
+	}
+	indexes := make([]int, 0, count)
+	selected := make(map[int]bool)
+	for i := uint64(0); len(indexes) < count; i++ {
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, i)
+		index := int(binary.BigEndian.Uint64(crypto.SHA256BytesFromBytes(bytes.Join([][]byte{seed, buf}, []byte{}))) % uint64(segments))
+		if !selected[index] {
+			selected[index] = true
+			indexes = append(indexes, index)
+		}
+	}
+	return &Challenge{
+		ID:         id,
+		Owner:      owner,
+		Hash:       hash,
+		MerkleRoot: merkleRoot,
+		Segments:   segments,
+		Indexes:    indexes,
+		Deadline:   deadline.Unix(),
+	}
+}
+
+// Expired returns whether the challenge is expired at the time.
+func (c *Challenge) Expired(now time.Time) bool {
+	return now.Unix() > c.Deadline
+}
+
+// Verify check the proofs whether prove all segments selected by the challenge.
+func (c *Challenge) Verify(proofs []crypto.MerkleProof) bool {
+	if len(proofs) != len(c.Indexes) {
+		return false
+	}
+	for i, index := range c.Indexes {
+		if proofs[i].Index != index || !proofs[i].Verify(c.MerkleRoot, c.Segments) {
+			return false
+		}
+	}
+	return true
+}
+
+// AddChallenge add the challenge to the sea.
+// Each owner can't open more than MaxOwnerChallenges challenges in the sea.
+func (s *Sea) AddChallenge(challenge *Challenge) error {
+	open := 0
+	for _, c := range s.Challenges {
+		if c.ID == challenge.ID {
+			return errors.New("challenge exists")
+		}
+		if c.Owner == challenge.Owner {
+			open++
+		}
+	}
+	if open >= MaxOwnerChallenges {
+		return errors.New("too many open challenges of owner")
+	}
+	s.Challenges = append(s.Challenges, *challenge)
+	return nil
+}
+
+// ExpireChallenges remove the expired challenges and record them as failures.
+// It returns the expired challenges.
+func (s *Sea) ExpireChallenges(now time.Time) []Challenge {
+	expired := make([]Challenge, 0)
+	challenges := make([]Challenge, 0, len(s.Challenges))
+	for _, c := range s.Challenges {
+		if c.Expired(now) {
+			expired = append(expired, c)
+		} else {
+			challenges = append(challenges, c)
+		}
+	}
+	s.Challenges = challenges
+	s.Failures += len(expired)
+	return expired
+}
+
+// RespondChallenge remove the challenge and verify the proofs.
+// The failed or expired response is recorded, it returns whether the proofs are accepted.
+func (s *Sea) RespondChallenge(id string, proofs []crypto.MerkleProof, now time.Time) (*Challenge, bool, error) {
+	for i, c := range s.Challenges {
+		if c.ID == id {
+			s.Challenges = append(s.Challenges[:i], s.Challenges[i+1:]...)
+			if c.Expired(now) || !c.Verify(proofs) {
+				s.Failures++
+				return &c, false, nil
+			}
+			s.Passes++
+			return &c, true, nil
+		}
+	}
+	return nil, false, errors.New("challenge doesn't exists")
+}
@@ -0,0 +1,34 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sea
+
+import "errors"
+
+// Decommission announce the sea is leaving the network.
+// The decommissioning sea isn't selected to store new fragments,
+// its fragments should be migrated to other seas by repair tasks.
+func (s *Sea) Decommission() error {
+	if s.Decommissioning {
+		return errors.New("sea is decommissioning")
+	}
+	s.Decommissioning = true
+	return nil
+}
+
+// Retired returns whether the decommissioning sea has migrated all fragments and confirmed all operations,
+// so that the sea can be removed.
+func (s *Sea) Retired() bool {
+	return s.Decommissioning && s.StoredCount == 0 && s.PendingOperations == 0
+}
@@ -0,0 +1,73 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sea
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sort"
+)
+
+// Index is the registry of seas, the addresses are sorted.
+type Index struct {
+	Addresses []string
+}
+
+func NewIndex() *Index {
+	return &Index{Addresses: make([]string, 0)}
+}
+
+// Add insert the address into the index, returns false if it exists.
+func (i *Index) Add(address string) bool {
+	n := sort.SearchStrings(i.Addresses, address)
+	if n < len(i.Addresses) && i.Addresses[n] == address {
+		return false
+	}
+	i.Addresses = append(i.Addresses, "")
+	copy(i.Addresses[n+1:], i.Addresses[n:])
+	i.Addresses[n] = address
+	return true
+}
+
+// Remove delete the address from the index, returns false if it doesn't exist.
+func (i *Index) Remove(address string) bool {
+	n := sort.SearchStrings(i.Addresses, address)
+	if n == len(i.Addresses) || i.Addresses[n] != address {
+		return false
+	}
+	i.Addresses = append(i.Addresses[:n], i.Addresses[n+1:]...)
+	return true
+}
+
+// Contains returns whether the address is in the index.
+func (i *Index) Contains(address string) bool {
+	n := sort.SearchStrings(i.Addresses, address)
+	return n < len(i.Addresses) && i.Addresses[n] == address
+}
+
+func (i *Index) ToBytes() []byte {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	_ = enc.Encode(i)
+	return buf.Bytes()
+}
+
+func IndexFromBytes(data []byte) (*Index, error) {
+	i := &Index{}
+	buf := bytes.NewBuffer(data)
+	dec := gob.NewDecoder(buf)
+	err := dec.Decode(i)
+	return i, err
+}
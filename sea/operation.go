@@ -0,0 +1,173 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sea
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"sort"
+)
+
+const (
+	// OperationPageSize is the count of operation IDs in each page.
+	OperationPageSize uint64 = 128
+	// MaxConfirmPages is the maximum count of pages touched by one confirmation.
+	MaxConfirmPages = 16
+)
+
+// OperationRange is the range of operation IDs from Start to End, End is exclusive.
+type OperationRange struct {
+	Start uint64
+	End   uint64
+}
+
+// NewOperationRange is the construct for OperationRange.
+func NewOperationRange(start, end uint64) *OperationRange {
+	return &OperationRange{Start: start, End: end}
+}
+
+// Contains returns whether the id is in the range.
+func (r OperationRange) Contains(id uint64) bool {
+	return id >= r.Start && id < r.End
+}
+
+// OperationPage returns the page number of the operation with the id.
+func OperationPage(id uint64) uint64 {
+	return id / OperationPageSize
+}
+
+// OperationPages returns the page numbers touched by the ranges in ascending order.
+func OperationPages(ranges []OperationRange) []uint64 {
+	seen := make(map[uint64]bool)
+	pages := make([]uint64, 0)
+	for _, r := range ranges {
+		if r.End <= r.Start {
+			continue
+		}
+		for page := OperationPage(r.Start); page <= OperationPage(r.End-1); page++ {
+			if !seen[page] {
+				seen[page] = true
+				pages = append(pages, page)
+			}
+		}
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i] < pages[j] })
+	return pages
+}
+
+// AddOperation assign the monotonic IDs to the operations.
+// The operations should be stored into the pages by their IDs.
+func (s *Sea) AddOperation(operations []*Operation) {
+	for _, operation := range operations {
+		operation.ID = s.NextOperationID
+		s.NextOperationID++
+		s.PendingOperations++
+	}
+}
+
+// ValidRanges check the ranges of operation IDs confirmed by the sea whether valid.
+// The ranges shouldn't be empty, overlapped or beyond the assigned IDs.
+func (s *Sea) ValidRanges(ranges []OperationRange) error {
+	if len(ranges) == 0 {
+		return errors.New("ranges of operations shouldn't be nil")
+	}
+	sorted := make([]OperationRange, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	for i, r := range sorted {
+		if r.End <= r.Start {
+			return errors.New("invalid range of operations")
+		}
+		if r.End > s.NextOperationID {
+			return errors.New("range of operations is beyond the assigned IDs")
+		}
+		if i > 0 && r.Start < sorted[i-1].End {
+			return errors.New("ranges of operations are overlapped")
+		}
+	}
+	if len(OperationPages(ranges)) > MaxConfirmPages {
+		return errors.New("too many pages of operations")
+	}
+	return nil
+}
+
+// Confirm apply the operations confirmed by the sea.
+// It returns the delete operations of fragments stored by the owners,
+// whose records should be removed from the stored pages to release the space.
+// The delete operations of shared copies don't release any space, as the fragments are still stored.
+func (s *Sea) Confirm(operations []Operation) []Operation {
+	deleted := make([]Operation, 0)
+	for _, operation := range operations {
+		if s.PendingOperations > 0 {
+			s.PendingOperations--
+		}
+		if (operation.Action == ActionUserDelete || operation.Action == ActionGroupDelete) && !operation.Shared {
+			deleted = append(deleted, operation)
+		}
+	}
+	return deleted
+}
+
+// Page is the page of operations not confirmed by the sea, the operations are sorted by ID.
+type Page struct {
+	Operations []Operation
+}
+
+// NewPage is the construct for Page.
+func NewPage() *Page {
+	return &Page{Operations: make([]Operation, 0)}
+}
+
+// Add append the operation into the page.
+func (page *Page) Add(operation Operation) {
+	page.Operations = append(page.Operations, operation)
+}
+
+// Remove remove the operations in the ranges from the page.
+// It returns the operations removed.
+func (page *Page) Remove(ranges []OperationRange) []Operation {
+	removed := make([]Operation, 0)
+	operations := make([]Operation, 0, len(page.Operations))
+L:
+	for _, operation := range page.Operations {
+		for _, r := range ranges {
+			if r.Contains(operation.ID) {
+				removed = append(removed, operation)
+				continue L
+			}
+		}
+		operations = append(operations, operation)
+	}
+	page.Operations = operations
+	return removed
+}
+
+// ToBytes convert page to byte slice.
+func (page *Page) ToBytes() []byte {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	_ = enc.Encode(page)
+	return buf.Bytes()
+}
+
+// PageFromBytes convert page from byte slice.
+func PageFromBytes(data []byte) (*Page, error) {
+	page := &Page{}
+	buf := bytes.NewBuffer(data)
+	dec := gob.NewDecoder(buf)
+	err := dec.Decode(page)
+	return page, err
+}
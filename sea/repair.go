@@ -0,0 +1,270 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sea
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"time"
+)
+
+const (
+	// RepairReputation is the reputation below which the fragments of sea should be repaired.
+	RepairReputation = 50
+	// RepairClaimTimeout is the duration for the claimer to complete the repair task.
+	RepairClaimTimeout = time.Hour
+	// StoredPageSize is the count of stored fragment IDs in each page.
+	StoredPageSize uint64 = 128
+	// RepairPageSize is the count of repair task IDs in each page.
+	RepairPageSize uint64 = 128
+)
+
+// StoredFragment is the reference of fragment stored in the sea.
+// Repairing is set when the repair task of fragment is queued, so that the task isn't added twice.
+type StoredFragment struct {
+	ID        uint64
+	Owner     string // owner address
+	Hash      string
+	Size      int64
+	Repairing bool
+	TaskID    uint64 // the ID of repair task if repairing
+}
+
+// NewStoredOperation returns the operation telling the sea the record of fragment it stored.
+func NewStoredOperation(stored StoredFragment) *Operation {
+	operation := NewOperation(ActionStored, stored.Owner, stored.Hash, stored.Size, false)
+	operation.StoredID = stored.ID
+	return operation
+}
+
+// StoredPageNumber returns the page number of the stored fragment with the id.
+func StoredPageNumber(id uint64) uint64 {
+	return id / StoredPageSize
+}
+
+// AddStored assign the monotonic ID to the fragment stored in the sea.
+// The fragment should be stored into the page by its ID.
+func (s *Sea) AddStored(stored *StoredFragment) {
+	stored.ID = s.NextStoredID
+	s.NextStoredID++
+	s.StoredCount++
+}
+
+// RemoveStored remove the record of fragment stored in the sea from the page by the id, owner address and hash,
+// and release the space of fragment. It returns nil if the record doesn't exist.
+func (s *Sea) RemoveStored(page *StoredPage, id uint64, owner, hash string) *StoredFragment {
+	for i, stored := range page.Fragments {
+		if stored.ID == id && stored.Owner == owner && stored.Hash == hash {
+			page.Fragments = append(page.Fragments[:i], page.Fragments[i+1:]...)
+			s.StoredCount--
+			s.Release(stored.Size)
+			return &stored
+		}
+	}
+	return nil
+}
+
+// NeedRepair returns whether the fragments stored in the sea should be repaired at the time.
+func (s *Sea) NeedRepair(now time.Time, liveness Liveness) bool {
+	return s.Status(now, liveness) == StatusOffline || s.Reputation() < RepairReputation
+}
+
+// StoredPage is the page of fragments stored in the sea, the fragments are sorted by ID.
+type StoredPage struct {
+	Fragments []StoredFragment
+}
+
+// NewStoredPage is the construct for StoredPage.
+func NewStoredPage() *StoredPage {
+	return &StoredPage{Fragments: make([]StoredFragment, 0)}
+}
+
+// Add append the stored fragment into the page.
+func (page *StoredPage) Add(stored StoredFragment) {
+	page.Fragments = append(page.Fragments, stored)
+}
+
+// ToBytes convert stored page to byte slice.
+func (page *StoredPage) ToBytes() []byte {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	_ = enc.Encode(page)
+	return buf.Bytes()
+}
+
+// StoredPageFromBytes convert stored page from byte slice.
+func StoredPageFromBytes(data []byte) (*StoredPage, error) {
+	page := &StoredPage{}
+	buf := bytes.NewBuffer(data)
+	dec := gob.NewDecoder(buf)
+	err := dec.Decode(page)
+	return page, err
+}
+
+// RepairTask requires a healthy sea to store the fragment instead of the source sea.
+type RepairTask struct {
+	ID        uint64
+	StoredID  uint64 // the ID of fragment stored in the source sea
+	Owner     string // owner address
+	Hash      string
+	Size      int64
+	Source    string // the address of failed sea
+	Claimer   string // the address of sea claimed the task
+	ClaimedAt int64
+}
+
+// RepairPageNumber returns the page number of the repair task with the id.
+func RepairPageNumber(id uint64) uint64 {
+	return id / RepairPageSize
+}
+
+// RepairQueue assign the monotonic IDs to the repair tasks,
+// the tasks are stored in the pages by their IDs.
+type RepairQueue struct {
+	NextID uint64
+}
+
+// NewRepairQueue is the construct for RepairQueue.
+func NewRepairQueue() *RepairQueue {
+	return &RepairQueue{NextID: 0}
+}
+
+// AddTasks add the repair tasks of fragments in the page stored in the source sea.
+// The fragments already being repaired are skipped, it returns the tasks added.
+func (rq *RepairQueue) AddTasks(source string, page *StoredPage) []RepairTask {
+	tasks := make([]RepairTask, 0)
+	for i := range page.Fragments {
+		fragment := &page.Fragments[i]
+		if fragment.Repairing {
+			continue
+		}
+		task := RepairTask{
+			ID:       rq.NextID,
+			StoredID: fragment.ID,
+			Owner:    fragment.Owner,
+			Hash:     fragment.Hash,
+			Size:     fragment.Size,
+			Source:   source,
+		}
+		rq.NextID++
+		fragment.Repairing = true
+		fragment.TaskID = task.ID
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+// ToBytes convert repair queue to byte slice.
+func (rq *RepairQueue) ToBytes() []byte {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	_ = enc.Encode(rq)
+	return buf.Bytes()
+}
+
+// RepairQueueFromBytes convert repair queue from byte slice.
+func RepairQueueFromBytes(data []byte) (*RepairQueue, error) {
+	rq := &RepairQueue{}
+	buf := bytes.NewBuffer(data)
+	dec := gob.NewDecoder(buf)
+	err := dec.Decode(rq)
+	return rq, err
+}
+
+// RepairPage is the page of repair tasks, the tasks are sorted by ID.
+type RepairPage struct {
+	Tasks []RepairTask
+}
+
+// NewRepairPage is the construct for RepairPage.
+func NewRepairPage() *RepairPage {
+	return &RepairPage{Tasks: make([]RepairTask, 0)}
+}
+
+// Add append the repair task into the page.
+func (page *RepairPage) Add(task RepairTask) {
+	page.Tasks = append(page.Tasks, task)
+}
+
+// GetTask returns the repair task by id.
+func (page *RepairPage) GetTask(id uint64) (*RepairTask, error) {
+	for i := range page.Tasks {
+		if page.Tasks[i].ID == id {
+			return &page.Tasks[i], nil
+		}
+	}
+	return nil, errors.New("repair task doesn't exists")
+}
+
+// Remove the repair task by id, it returns false if the task doesn't exist.
+func (page *RepairPage) Remove(id uint64) bool {
+	for i, task := range page.Tasks {
+		if task.ID == id {
+			page.Tasks = append(page.Tasks[:i], page.Tasks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Claim assign the repair task to the sea.
+// The task claimed by another sea can be claimed again after RepairClaimTimeout.
+func (page *RepairPage) Claim(id uint64, address string, now time.Time) (*RepairTask, error) {
+	task, err := page.GetTask(id)
+	if err != nil {
+		return nil, err
+	}
+	if task.Source == address {
+		return nil, errors.New("source sea can't claim its repair task")
+	}
+	if task.Claimer != "" && task.Claimer != address && now.Before(time.Unix(task.ClaimedAt, 0).Add(RepairClaimTimeout)) {
+		return nil, errors.New("repair task is claimed")
+	}
+	task.Claimer = address
+	task.ClaimedAt = now.Unix()
+	return task, nil
+}
+
+// Complete remove the repair task claimed by the sea.
+func (page *RepairPage) Complete(id uint64, address string) (*RepairTask, error) {
+	task, err := page.GetTask(id)
+	if err != nil {
+		return nil, err
+	}
+	if task.Claimer != address {
+		return nil, errors.New("repair task isn't claimed by sea")
+	}
+	completed := *task
+	page.Remove(id)
+	return &completed, nil
+}
+
+// ToBytes convert repair page to byte slice.
+func (page *RepairPage) ToBytes() []byte {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	_ = enc.Encode(page)
+	return buf.Bytes()
+}
+
+// RepairPageFromBytes convert repair page from byte slice.
+func RepairPageFromBytes(data []byte) (*RepairPage, error) {
+	page := &RepairPage{}
+	buf := bytes.NewBuffer(data)
+	dec := gob.NewDecoder(buf)
+	err := dec.Decode(page)
+	return page, err
+}
@@ -0,0 +1,137 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sea
+
+import (
+	"errors"
+	"time"
+)
+
+// The default liveness rule, used if it isn't set in the on-chain settings.
+const (
+	DefaultActivityInterval = 10 * time.Minute
+	DefaultSuspectIntervals = 3
+	DefaultOfflineIntervals = 12
+)
+
+// Liveness is the rule to evaluate the liveness of sea.
+// It is a consensus rule, every validator should use the same value, so it is read from the on-chain settings.
+type Liveness struct {
+	ActivityInterval time.Duration // the interval to count the uptime of sea
+	SuspectIntervals int           // the count of missed intervals to mark the sea as suspect
+	OfflineIntervals int           // the count of missed intervals to mark the sea as offline
+}
+
+// DefaultLiveness returns the default liveness rule.
+func DefaultLiveness() Liveness {
+	return Liveness{
+		ActivityInterval: DefaultActivityInterval,
+		SuspectIntervals: DefaultSuspectIntervals,
+		OfflineIntervals: DefaultOfflineIntervals,
+	}
+}
+
+// Validate returns error if the liveness rule can't be applied.
+func (l Liveness) Validate() error {
+	if l.ActivityInterval < time.Second {
+		return errors.New("activity interval should be at least one second")
+	}
+	if l.SuspectIntervals <= 0 || l.OfflineIntervals < l.SuspectIntervals {
+		return errors.New("invalid suspect or offline intervals")
+	}
+	return nil
+}
+
+// Active record the activity of sea at the time.
+// The interval with activity is counted as online, the intervals passed without activity are counted as missed.
+func (s *Sea) Active(now time.Time, liveness Liveness) {
+	interval := int64(liveness.ActivityInterval / time.Second)
+	if s.LastActive == 0 {
+		s.OnlineIntervals++
+	} else if current, last := now.Unix()/interval, s.LastActive/interval; current > last {
+		s.OnlineIntervals++
+		s.MissedIntervals += int(current - last - 1)
+	}
+	s.LastActive = now.Unix()
+}
+
+// Unconfirmed returns the count of operations the sea hasn't confirmed.
+func (s *Sea) Unconfirmed() int {
+	return s.PendingOperations
+}
+
+// Reputation returns the score of sea in percent.
+// It is the product of the rate of passed challenges, the rate of uptime and the rate of confirmed operations.
+// Integer arithmetic is used, so that every validator computes the same score.
+func (s *Sea) Reputation() int {
+	score := 100
+	score = score * (s.Passes + 1) / (s.Passes + s.Failures + 1)
+	score = score * (s.OnlineIntervals + 1) / (s.OnlineIntervals + s.MissedIntervals + 1)
+	score = score * (s.Handles + 1) / (s.Handles + s.Unconfirmed() + 1)
+	return score
+}
+
+// Weight returns the reputation as the weight of fragment stored in the sea.
+func (s *Sea) Weight() int8 {
+	return int8(s.Reputation())
+}
+
+// Status is the liveness of sea.
+type Status uint8
+
+var (
+	StatusOnline  Status = 0
+	StatusSuspect Status = 1
+	StatusOffline Status = 2
+)
+
+func (st Status) String() string {
+	switch st {
+	case StatusOnline:
+		return "online"
+	case StatusSuspect:
+		return "suspect"
+	case StatusOffline:
+		return "offline"
+	default:
+		return "unknown"
+	}
+}
+
+// Heartbeat record the sea is alive at the time.
+func (s *Sea) Heartbeat(now time.Time, liveness Liveness) {
+	s.Active(now, liveness)
+}
+
+// Missed returns the count of intervals passed without activity until the time.
+func (s *Sea) Missed(now time.Time, liveness Liveness) int {
+	interval := int64(liveness.ActivityInterval / time.Second)
+	missed := now.Unix()/interval - s.LastActive/interval - 1
+	if missed < 0 {
+		return 0
+	}
+	return int(missed)
+}
+
+// Status returns the liveness of sea at the time.
+func (s *Sea) Status(now time.Time, liveness Liveness) Status {
+	missed := s.Missed(now, liveness)
+	if missed >= liveness.OfflineIntervals {
+		return StatusOffline
+	} else if missed >= liveness.SuspectIntervals {
+		return StatusSuspect
+	}
+	return StatusOnline
+}
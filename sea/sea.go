@@ -17,6 +17,7 @@ package sea
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
 )
 
 var (
@@ -24,52 +25,147 @@ var (
 	ActionUserShared  uint = 2
 	ActionGroupDelete uint = 3
 	ActionGroupShared uint = 4
+	// ActionStored tells the sea the record of fragment it stored, so that it references the fragment by StoredID.
+	ActionStored uint = 5
 )
 
 type Operation struct {
-	Action uint   // delete or shared
-	Owner  string // owner public key
-	Hash   string // the hash of file or fragment
-	Shared bool   // whether target is shared file or owner file
+	ID       uint64 // assigned by the sea in order
+	Action   uint   // delete, shared or stored
+	Owner    string // owner address
+	Hash     string // the hash of file or fragment
+	Size     int64  // the size of fragment
+	Shared   bool   // whether target is shared file or owner file
+	StoredID uint64 // the ID of fragment stored in the sea, used by delete
+	Ref      string // the reference of share, the public key of share link
 }
 
+// Sea is the storage provider.
+// Capacity and Used are in bytes, Price is per GB-month.
 type Sea struct {
-	PublicKey  string
-	Handles    int
-	Operations []Operation
+	PublicKey         string
+	Handles           int
+	NextOperationID   uint64
+	PendingOperations int
+	Challenges        []Challenge
+	Failures          int
+	Passes            int
+	OnlineIntervals   int
+	MissedIntervals   int
+	LastActive        int64
+	NextStoredID      uint64
+	StoredCount       int
+	Capacity          int64
+	Used              int64
+	Price             int64
+	Region            string
+	Zone              string
+	Endpoint          string
+	Decommissioning   bool
+	Balance           int64
 }
 
-func NewOperation(action uint, owner string, hash string, shared bool) *Operation {
+// SeaInfo is the information declared by the sea.
+type SeaInfo struct {
+	Capacity int64
+	Price    int64
+	Region   string
+	Zone     string
+	Endpoint string
+}
+
+func NewOperation(action uint, owner string, hash string, size int64, shared bool) *Operation {
 	return &Operation{
 		Action: action,
 		Owner:  owner,
 		Hash:   hash,
+		Size:   size,
 		Shared: shared,
 	}
 }
 
-func NewSea(publicKey string) *Sea {
+func NewSea(publicKey string, info SeaInfo) *Sea {
 	return &Sea{
-		PublicKey:  publicKey,
-		Handles:    0,
-		Operations: make([]Operation, 0),
+		PublicKey:         publicKey,
+		Handles:           0,
+		NextOperationID:   0,
+		PendingOperations: 0,
+		Challenges:        make([]Challenge, 0),
+		Failures:          0,
+		Capacity:          info.Capacity,
+		Used:              0,
+		Price:             info.Price,
+		Region:            info.Region,
+		Zone:              info.Zone,
+		Endpoint:          info.Endpoint,
+		Decommissioning:   false,
+		Balance:           0,
+	}
+}
+
+func NewSeaInfo(capacity, price int64, region, zone, endpoint string) *SeaInfo {
+	return &SeaInfo{
+		Capacity: capacity,
+		Price:    price,
+		Region:   region,
+		Zone:     zone,
+		Endpoint: endpoint,
 	}
 }
 
-func (s *Sea) AddOperation(operations []*Operation) {
-	for _, operation := range operations {
-		s.Operations = append(s.Operations, *operation)
+// Valid check the information of sea whether valid.
+func (info SeaInfo) Valid() error {
+	if info.Capacity <= 0 {
+		return errors.New("capacity of sea should be positive")
+	}
+	if info.Price < 0 {
+		return errors.New("price of sea shouldn't be negative")
+	}
+	if info.Endpoint == "" {
+		return errors.New("endpoint of sea shouldn't be nil")
+	}
+	return nil
+}
+
+// UpdateInfo update the information declared by the sea.
+func (s *Sea) UpdateInfo(info SeaInfo) error {
+	err := info.Valid()
+	if err != nil {
+		return err
+	}
+	s.Capacity = info.Capacity
+	s.Price = info.Price
+	s.Region = info.Region
+	s.Zone = info.Zone
+	s.Endpoint = info.Endpoint
+	return nil
+}
+
+// Free returns the free space of sea.
+func (s *Sea) Free() int64 {
+	if s.Used >= s.Capacity {
+		return 0
+	}
+	return s.Capacity - s.Used
+}
+
+// Reserve add the size of stored fragment to used space.
+func (s *Sea) Reserve(size int64) error {
+	if size < 0 {
+		return errors.New("invalid size of fragment")
+	}
+	if size > s.Free() {
+		return errors.New("sea hasn't enough free space")
 	}
+	s.Used += size
+	return nil
 }
 
-func (s *Sea) RemoveOperations(operations []Operation) {
-	for _, operation := range operations {
-		for i, seaOperation := range s.Operations {
-			if operation == seaOperation {
-				s.Operations = append(s.Operations[:i], s.Operations[i+1:]...)
-				break
-			}
-		}
+// Release remove the size of deleted fragment from used space.
+func (s *Sea) Release(size int64) {
+	s.Used -= size
+	if s.Used < 0 {
+		s.Used = 0
 	}
 }
 
@@ -1,13 +1,17 @@
 package sea
 
 import (
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/yellowssi/SeaStorage-TP/crypto"
 )
 
 var s *Sea
 
 func init() {
-	s = NewSea("public key")
+	s = NewSea("public key", *NewSeaInfo(1024, 10, "asia", "asia-east", "http://localhost:8080"))
 }
 
 func TestSea_AddOperation(t *testing.T) {
@@ -25,21 +29,36 @@ func TestSea_AddOperation(t *testing.T) {
 	for _, operation := range operations {
 		s.AddOperation([]*Operation{operation})
 	}
+	if operations[0].ID != 0 || operations[1].ID != 1 || s.Unconfirmed() != 2 {
+		t.Error("operations should be assigned with monotonic IDs")
+	}
 	t.Log(s)
 }
 
-func TestSea_RemoveOperations(t *testing.T) {
-	s.RemoveOperations([]Operation{{
-		Action: ActionUserDelete,
-		Owner:  "test1",
-		Hash:   "hash",
-		Shared: false,
-	}, {
-		Action: ActionUserDelete,
-		Owner:  "test2",
-		Hash:   "hash",
-		Shared: false,
-	}})
+func TestPage_Remove(t *testing.T) {
+	page := NewPage()
+	for id := uint64(0); id < 4; id++ {
+		page.Add(Operation{ID: id, Action: ActionUserDelete, Owner: "test", Hash: "hash"})
+	}
+	ranges := []OperationRange{*NewOperationRange(0, 1), *NewOperationRange(2, 4)}
+	if s.ValidRanges(ranges) == nil {
+		t.Error("range beyond the assigned IDs should be invalid")
+	}
+	removed := page.Remove(ranges)
+	if len(removed) != 3 || len(page.Operations) != 1 || page.Operations[0].ID != 1 {
+		t.Error("operations in the ranges should be removed")
+	}
+	err := s.ValidRanges([]OperationRange{*NewOperationRange(0, 2), *NewOperationRange(1, 2)})
+	if err == nil {
+		t.Error("overlapped ranges should be invalid")
+	}
+	removed[1].Shared = true
+	if len(s.Confirm(removed[:2])) != 1 {
+		t.Error("delete operation of shared copy shouldn't remove the stored fragment")
+	}
+	if s.Unconfirmed() != 0 {
+		t.Error("confirmed operations should be removed")
+	}
 	t.Log(s)
 }
 
@@ -51,3 +70,273 @@ func TestSea_ToBytes(t *testing.T) {
 	}
 	t.Log(test)
 }
+
+func TestSea_RespondChallenge(t *testing.T) {
+	data := make([]byte, 10*crypto.MerkleSegmentSize)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	challenge := NewChallenge("id", "owner", "hash", crypto.MerkleRoot(data), int64(len(data)), []byte("seed"), time.Now().Add(time.Hour))
+	t.Log(challenge.Indexes)
+	err := s.AddChallenge(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proofs := make([]crypto.MerkleProof, len(challenge.Indexes))
+	for i, index := range challenge.Indexes {
+		proof, err := crypto.NewMerkleProof(data, index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proofs[i] = *proof
+	}
+	_, ok, err := s.RespondChallenge("id", proofs, time.Now())
+	if err != nil || !ok {
+		t.Error("valid proofs should be accepted")
+	}
+	_ = s.AddChallenge(challenge)
+	_, ok, err = s.RespondChallenge("id", proofs[1:], time.Now())
+	if err != nil || ok {
+		t.Error("invalid proofs should be rejected")
+	}
+	_ = s.AddChallenge(challenge)
+	expired := s.ExpireChallenges(time.Now().Add(2 * time.Hour))
+	if len(expired) != 1 || s.Failures != 2 {
+		t.Errorf("failures should be recorded: %d", s.Failures)
+	}
+}
+
+func TestSea_AddChallengeLimit(t *testing.T) {
+	test := NewSea("public key", *NewSeaInfo(100, 10, "asia", "asia-east", "http://localhost:8080"))
+	deadline := time.Now().Add(time.Hour)
+	for i := 0; i < MaxOwnerChallenges; i++ {
+		err := test.AddChallenge(NewChallenge(strconv.Itoa(i), "owner", "hash", "root", 1, []byte("seed"), deadline))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if test.AddChallenge(NewChallenge("more", "owner", "hash", "root", 1, []byte("seed"), deadline)) == nil {
+		t.Error("open challenges of owner should be limited")
+	}
+	if test.AddChallenge(NewChallenge("other", "other", "hash", "root", 1, []byte("seed"), deadline)) != nil {
+		t.Error("challenges of other owner should be accepted")
+	}
+}
+
+func TestSea_Reserve(t *testing.T) {
+	test := NewSea("public key", *NewSeaInfo(100, 10, "asia", "asia-east", "http://localhost:8080"))
+	if err := test.Reserve(60); err != nil {
+		t.Error(err)
+	}
+	if err := test.Reserve(60); err == nil {
+		t.Error("reserve should fail without enough free space")
+	}
+	test.Release(20)
+	if test.Free() != 60 {
+		t.Errorf("invalid free space: %d", test.Free())
+	}
+	if err := test.UpdateInfo(SeaInfo{Capacity: 0, Endpoint: "http://localhost:8080"}); err == nil {
+		t.Error("capacity should be positive")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	index := NewIndex()
+	for _, address := range []string{"c", "a", "b", "a"} {
+		index.Add(address)
+	}
+	if len(index.Addresses) != 3 || index.Addresses[0] != "a" || index.Addresses[2] != "c" {
+		t.Errorf("invalid index: %v", index.Addresses)
+	}
+	index.Remove("b")
+	test, err := IndexFromBytes(index.ToBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if test.Contains("b") || !test.Contains("c") {
+		t.Errorf("invalid index: %v", test.Addresses)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	now := time.Now()
+	candidates := make([]Candidate, 0)
+	for i, region := range []string{"asia", "asia", "europe", "america", "asia", "europe"} {
+		candidate := Candidate{
+			Address: string(rune('a' + i)),
+			Sea:     NewSea("public key", *NewSeaInfo(int64(100*(i+1)), 10, region, "", "http://localhost:8080")),
+		}
+		candidate.Sea.Heartbeat(now, DefaultLiveness())
+		candidates = append(candidates, candidate)
+	}
+	candidates[5].Sea.LastActive = now.Add(-time.Duration(DefaultOfflineIntervals+1) * DefaultActivityInterval).Unix()
+	t.Log(List(candidates, now, DefaultLiveness()))
+	constraints := Constraints{MinFree: 150, RegionDiversity: true}
+	selected, err := Select("hash", 3, candidates, constraints, now, DefaultLiveness())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(selected)
+	again, _ := Select("hash", 3, []Candidate{candidates[5], candidates[4], candidates[3], candidates[2], candidates[1], candidates[0]}, constraints, now, DefaultLiveness())
+	for i := range selected {
+		if selected[i] != again[i] {
+			t.Error("selection should be deterministic")
+		}
+	}
+	regions := make(map[string]bool)
+	for _, candidate := range candidates {
+		for _, address := range selected {
+			if candidate.Address == address {
+				regions[candidate.Sea.Region] = true
+			}
+		}
+	}
+	if len(regions) != 3 {
+		t.Error("seas in distinct regions should be preferred")
+	}
+	for _, address := range selected {
+		if address == candidates[5].Address {
+			t.Error("offline sea shouldn't be selected")
+		}
+	}
+	_, err = Select("hash", 5, candidates, constraints, now, DefaultLiveness())
+	if err == nil {
+		t.Error("selection should fail without enough seas")
+	}
+}
+
+func TestSea_Reputation(t *testing.T) {
+	test := NewSea("public key", *NewSeaInfo(100, 10, "asia", "asia-east", "http://localhost:8080"))
+	now := time.Now()
+	test.Active(now, DefaultLiveness())
+	if test.Reputation() != 100 {
+		t.Errorf("new sea should have full reputation: %d", test.Reputation())
+	}
+	test.Active(now.Add(4*DefaultActivityInterval), DefaultLiveness())
+	if test.MissedIntervals != 3 {
+		t.Errorf("missed intervals should be counted: %d", test.MissedIntervals)
+	}
+	uptime := test.Reputation()
+	test.Failures++
+	if test.Reputation() >= uptime {
+		t.Error("failures should decrease reputation")
+	}
+	t.Log(test.Reputation(), test.Weight())
+}
+
+func TestSea_Status(t *testing.T) {
+	test := NewSea("public key", *NewSeaInfo(100, 10, "asia", "asia-east", "http://localhost:8080"))
+	now := time.Now()
+	test.Heartbeat(now, DefaultLiveness())
+	if test.Status(now.Add(DefaultActivityInterval), DefaultLiveness()) != StatusOnline {
+		t.Error("sea should be online")
+	}
+	if test.Status(now.Add(time.Duration(DefaultSuspectIntervals+1)*DefaultActivityInterval), DefaultLiveness()) != StatusSuspect {
+		t.Error("sea should be suspect")
+	}
+	if test.Status(now.Add(time.Duration(DefaultOfflineIntervals+1)*DefaultActivityInterval), DefaultLiveness()) != StatusOffline {
+		t.Error("sea should be offline")
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	test := NewSea("public key", *NewSeaInfo(100, 10, "asia", "asia-east", "http://localhost:8080"))
+	now := time.Now()
+	liveness := Liveness{ActivityInterval: time.Hour, SuspectIntervals: 1, OfflineIntervals: 2}
+	if err := liveness.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	test.Heartbeat(now, liveness)
+	if test.Status(now.Add(2*time.Hour), liveness) != StatusSuspect {
+		t.Error("sea should be suspect by the liveness")
+	}
+	if test.Status(now.Add(2*time.Hour), DefaultLiveness()) == StatusOnline {
+		t.Error("sea should not be online by the default liveness")
+	}
+	if test.Status(now.Add(time.Hour), liveness) != StatusOnline {
+		t.Error("sea should be online by the liveness")
+	}
+	if (Liveness{ActivityInterval: time.Hour, SuspectIntervals: 2, OfflineIntervals: 1}).Validate() == nil {
+		t.Error("offline intervals should not be less than suspect intervals")
+	}
+}
+
+func TestRepairQueue(t *testing.T) {
+	rq := NewRepairQueue()
+	stored := NewStoredPage()
+	stored.Add(StoredFragment{ID: 0, Owner: "owner", Hash: "hash", Size: 10})
+	tasks := rq.AddTasks("source", stored)
+	if len(tasks) != 1 || !stored.Fragments[0].Repairing || stored.Fragments[0].TaskID != tasks[0].ID {
+		t.Fatal("repair task should be added")
+	}
+	if len(rq.AddTasks("source", stored)) != 0 {
+		t.Error("repair task shouldn't be added twice")
+	}
+	page := NewRepairPage()
+	page.Add(tasks[0])
+	now := time.Now()
+	_, err := page.Claim(0, "source", now)
+	if err == nil {
+		t.Error("source sea shouldn't claim the repair task")
+	}
+	task, err := page.Claim(0, "target", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = page.Complete(task.ID, "other")
+	if err == nil {
+		t.Error("repair task should be completed by the claimer")
+	}
+	task, err = page.Complete(task.ID, "target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.StoredID != 0 || task.Source != "source" {
+		t.Error("completed task should be returned")
+	}
+	page, err = RepairPageFromBytes(page.ToBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Tasks) != 0 {
+		t.Error("completed task should be removed")
+	}
+	rq, err = RepairQueueFromBytes(rq.ToBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rq.NextID != 1 {
+		t.Error("id of repair task should be assigned")
+	}
+}
+
+func TestSea_Decommission(t *testing.T) {
+	test := NewSea("public key", *NewSeaInfo(100, 10, "asia", "asia-east", "http://localhost:8080"))
+	now := time.Now()
+	test.Heartbeat(now, DefaultLiveness())
+	stored := StoredFragment{Owner: "owner", Hash: "hash", Size: 10}
+	_ = test.Reserve(stored.Size)
+	test.AddStored(&stored)
+	page := NewStoredPage()
+	page.Add(stored)
+	err := test.Decommission()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if test.Satisfy(Constraints{}, now, DefaultLiveness()) {
+		t.Error("decommissioning sea shouldn't be selected")
+	}
+	if test.Retired() {
+		t.Error("sea storing fragments shouldn't be retired")
+	}
+	if test.RemoveStored(page, stored.ID, "other", "hash") != nil {
+		t.Error("fragment of other owner shouldn't be removed")
+	}
+	test.RemoveStored(page, stored.ID, "owner", "hash")
+	if test.Used != 0 {
+		t.Error("space of removed fragment should be released")
+	}
+	if !test.Retired() {
+		t.Error("sea should be retired")
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sea
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/yellowssi/SeaStorage-TP/crypto"
+)
+
+// Constraints limit the seas selected to store the fragment.
+// MinFree is the minimum free space of sea, usually the size of fragment.
+// MinReputation is the minimum reputation of sea in percent.
+// RegionDiversity prefers the seas in distinct regions.
+// AllowSuspect allows the suspect seas to be selected, the offline or decommissioning seas are never selected.
+type Constraints struct {
+	MinFree         int64
+	MinReputation   int
+	RegionDiversity bool
+	AllowSuspect    bool
+}
+
+// Candidate is the sea can be selected.
+type Candidate struct {
+	Address string
+	Sea     *Sea
+}
+
+// Satisfy returns whether the sea satisfies the constraints at the time.
+func (s *Sea) Satisfy(constraints Constraints, now time.Time, liveness Liveness) bool {
+	if s.Decommissioning {
+		return false
+	}
+	switch s.Status(now, liveness) {
+	case StatusOffline:
+		return false
+	case StatusSuspect:
+		if !constraints.AllowSuspect {
+			return false
+		}
+	}
+	return s.Free() >= constraints.MinFree && s.Reputation() >= constraints.MinReputation
+}
+
+// The rendezvous score of sea for the fragment.
+func score(hash, address string) uint64 {
+	return binary.BigEndian.Uint64(crypto.SHA256BytesFromBytes([]byte(hash + address)))
+}
+
+// Select returns the addresses of seas to store the fragment with the hash in order.
+// The candidates satisfying the constraints are ranked by rendezvous hashing of fragment hash and sea address,
+// so that every client with the same candidates read from the registry selects the same seas.
+// If RegionDiversity is set, the seas in regions not selected yet are preferred.
+// The liveness of seas is evaluated at the time by the liveness rule.
+func Select(hash string, replicas int, candidates []Candidate, constraints Constraints, now time.Time, liveness Liveness) ([]string, error) {
+	if replicas <= 0 {
+		return nil, errors.New("replicas should be positive")
+	}
+	ranked := make([]Candidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.Sea != nil && candidate.Sea.Satisfy(constraints, now, liveness) {
+			ranked = append(ranked, candidate)
+		}
+	}
+	if len(ranked) < replicas {
+		return nil, errors.New("not enough seas satisfy the constraints")
+	}
+	scores := make(map[string]uint64)
+	for _, candidate := range ranked {
+		scores[candidate.Address] = score(hash, candidate.Address)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		si, sj := scores[ranked[i].Address], scores[ranked[j].Address]
+		if si != sj {
+			return si > sj
+		}
+		return ranked[i].Address < ranked[j].Address
+	})
+	selected := make([]string, 0, replicas)
+	used := make(map[string]bool)
+	if constraints.RegionDiversity {
+		regions := make(map[string]bool)
+		for _, candidate := range ranked {
+			if len(selected) == replicas {
+				break
+			}
+			if !regions[candidate.Sea.Region] {
+				regions[candidate.Sea.Region] = true
+				used[candidate.Address] = true
+				selected = append(selected, candidate.Address)
+			}
+		}
+	}
+	for _, candidate := range ranked {
+		if len(selected) == replicas {
+			break
+		}
+		if !used[candidate.Address] {
+			used[candidate.Address] = true
+			selected = append(selected, candidate.Address)
+		}
+	}
+	return selected, nil
+}
+
+// Listing is the summary of sea for clients to choose.
+type Listing struct {
+	Address         string
+	Status          Status
+	Reputation      int
+	Free            int64
+	Price           int64
+	Region          string
+	Zone            string
+	Endpoint        string
+	Decommissioning bool
+}
+
+// List returns the summaries of candidates at the time.
+func List(candidates []Candidate, now time.Time, liveness Liveness) []Listing {
+	listings := make([]Listing, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.Sea == nil {
+			continue
+		}
+		s := candidate.Sea
+		listings = append(listings, Listing{
+			Address:         candidate.Address,
+			Status:          s.Status(now, liveness),
+			Reputation:      s.Reputation(),
+			Free:            s.Free(),
+			Price:           s.Price,
+			Region:          s.Region,
+			Zone:            s.Zone,
+			Endpoint:        s.Endpoint,
+			Decommissioning: s.Decommissioning,
+		})
+	}
+	return listings
+}
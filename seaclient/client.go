@@ -0,0 +1,274 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seaclient
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/sawtooth-sdk-go/protobuf/transaction_pb2"
+	"github.com/hyperledger/sawtooth-sdk-go/signing"
+	"github.com/yellowssi/SeaStorage-TP/blob"
+	"github.com/yellowssi/SeaStorage-TP/payload"
+	"github.com/yellowssi/SeaStorage-TP/sea"
+	"github.com/yellowssi/SeaStorage-TP/state"
+	"github.com/yellowssi/SeaStorage-TP/storage"
+	"github.com/yellowssi/SeaStorage-TP/user"
+)
+
+// Client watches the operations sent to the sea, applies them to the local store
+// and confirms them by the transactions signed by the sea.
+type Client struct {
+	URL        string // the url of REST API of validator
+	Name       string
+	Address    string
+	HTTPClient *http.Client
+	signer     *signing.Signer
+	store      blob.Store
+}
+
+// NewClient is the construct for Client.
+func NewClient(url, name string, signer *signing.Signer, store blob.Store) *Client {
+	return &Client{
+		URL:        url,
+		Name:       name,
+		Address:    state.MakeAddress(state.AddressTypeSea, name, signer.GetPublicKey().AsHex()),
+		HTTPClient: &http.Client{Timeout: time.Minute},
+		signer:     signer,
+		store:      store,
+	}
+}
+
+// GetSea returns the state of the sea.
+func (c *Client) GetSea() (*sea.Sea, error) {
+	data, err := c.getState(c.Address)
+	if err != nil {
+		return nil, err
+	}
+	return sea.SeaFromBytes(data)
+}
+
+// VerifyPublicKey check the public key whether authorized device of the user in the address,
+// so that the Client resolves the accounts for the transfer server.
+func (c *Client) VerifyPublicKey(address, publicKey string) (bool, error) {
+	if len(address) != 70 || !strings.HasPrefix(address, state.Namespace+state.UserNamespace) {
+		return false, nil
+	}
+	data, err := c.getState(address)
+	if err == errNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	u, err := user.UserFromBytes(data)
+	if err != nil {
+		return false, err
+	}
+	return u.VerifyPublicKey(publicKey), nil
+}
+
+// GetOperations returns the operations not confirmed by the sea in the order of IDs.
+func (c *Client) GetOperations() ([]sea.Operation, error) {
+	pages, err := c.listState(state.MakeOperationPrefix(c.Address))
+	if err != nil {
+		return nil, err
+	}
+	operations := make([]sea.Operation, 0)
+	for _, data := range pages {
+		page, err := sea.PageFromBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, page.Operations...)
+	}
+	sort.Slice(operations, func(i, j int) bool { return operations[i].ID < operations[j].ID })
+	return operations, nil
+}
+
+// Returns the reference of share in the local store.
+// The share link is referenced by its public key, the copy in 'shared' directory by the stored record.
+func shareRef(operation sea.Operation) string {
+	if operation.Ref != "" {
+		return operation.Ref
+	}
+	return strconv.FormatUint(operation.StoredID, 10)
+}
+
+// Apply the operation to the local store.
+// The operations are applied idempotently, because they may be applied again before the confirmation is committed.
+func (c *Client) apply(operation sea.Operation) error {
+	var err error
+	switch operation.Action {
+	case sea.ActionStored:
+		err = c.store.Reference(operation.Owner, operation.Hash, operation.StoredID)
+	case sea.ActionUserDelete, sea.ActionGroupDelete:
+		if operation.Shared {
+			err = c.store.Share(operation.Owner, operation.Hash, shareRef(operation), false)
+		} else {
+			err = c.store.Delete(operation.Owner, operation.Hash, operation.StoredID)
+		}
+	case sea.ActionUserShared, sea.ActionGroupShared:
+		err = c.store.Share(operation.Owner, operation.Hash, shareRef(operation), true)
+	}
+	if err == blob.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// Process apply the operations to the local store.
+// It returns the IDs of operations applied and the first error occurred,
+// the operations failed are left to be applied in the next round.
+func (c *Client) Process(operations []sea.Operation) ([]uint64, error) {
+	var firstErr error
+	ids := make([]uint64, 0, len(operations))
+	for _, operation := range operations {
+		err := c.apply(operation)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		ids = append(ids, operation.ID)
+	}
+	return ids, firstErr
+}
+
+// Confirm submit the confirmations of operations with the IDs in one batch.
+// The IDs are merged into ranges and split into transactions by MaxConfirmPages.
+func (c *Client) Confirm(ids []uint64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	for _, ranges := range SplitRanges(Ranges(ids)) {
+		transactions := make([]*transaction_pb2.Transaction, 0, len(ranges))
+		for _, r := range ranges {
+			pl := payload.NewSeaStoragePayload(payload.SeaConfirmOperations, c.Name, "/", nil, "", storage.FileInfo{}, nil, r)
+			transaction, err := c.newTransaction(pl)
+			if err != nil {
+				return err
+			}
+			transactions = append(transactions, transaction)
+		}
+		batchList, err := c.newBatchList(transactions)
+		if err != nil {
+			return err
+		}
+		err = c.submit(batchList)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sync process the operations not confirmed and confirm the operations applied.
+func (c *Client) Sync() error {
+	operations, err := c.GetOperations()
+	if err != nil {
+		return err
+	}
+	ids, processErr := c.Process(operations)
+	err = c.Confirm(ids)
+	if err != nil {
+		return err
+	}
+	return processErr
+}
+
+// Run sync the operations every interval until the context is done.
+// The errors of every round are passed to onError if it isn't nil.
+func (c *Client) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := c.Sync()
+		if err != nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Ranges merge the IDs into the ranges of consecutive IDs in ascending order.
+func Ranges(ids []uint64) []sea.OperationRange {
+	sorted := make([]uint64, len(ids))
+	copy(sorted, ids)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	ranges := make([]sea.OperationRange, 0)
+	for _, id := range sorted {
+		if n := len(ranges); n > 0 && ranges[n-1].End >= id {
+			if ranges[n-1].End == id {
+				ranges[n-1].End++
+			}
+			continue
+		}
+		ranges = append(ranges, *sea.NewOperationRange(id, id+1))
+	}
+	return ranges
+}
+
+// SplitRanges split the ranges into the groups of transactions and batches.
+// Each group of ranges touches MaxConfirmPages pages at most, and each batch has MaxBatchTransactions groups at most.
+func SplitRanges(ranges []sea.OperationRange) [][][]sea.OperationRange {
+	pieces := make([]sea.OperationRange, 0, len(ranges))
+	for _, r := range ranges {
+		for start := r.Start; start < r.End; {
+			end := (sea.OperationPage(start) + 1) * sea.OperationPageSize
+			if end > r.End {
+				end = r.End
+			}
+			pieces = append(pieces, *sea.NewOperationRange(start, end))
+			start = end
+		}
+	}
+	groups := make([][]sea.OperationRange, 0)
+	var group []sea.OperationRange
+	var lastPage uint64
+	pages := 0
+	for _, piece := range pieces {
+		page := sea.OperationPage(piece.Start)
+		if len(group) == 0 || page != lastPage {
+			if pages == sea.MaxConfirmPages {
+				groups = append(groups, group)
+				group, pages = nil, 0
+			}
+			pages++
+			lastPage = page
+		}
+		group = append(group, piece)
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	batches := make([][][]sea.OperationRange, 0)
+	for len(groups) > MaxBatchTransactions {
+		batches = append(batches, groups[:MaxBatchTransactions])
+		groups = groups[MaxBatchTransactions:]
+	}
+	if len(groups) > 0 {
+		batches = append(batches, groups)
+	}
+	return batches
+}
@@ -0,0 +1,137 @@
+package seaclient
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/sawtooth-sdk-go/protobuf/batch_pb2"
+	"github.com/hyperledger/sawtooth-sdk-go/signing"
+	"github.com/yellowssi/SeaStorage-TP/blob"
+	"github.com/yellowssi/SeaStorage-TP/crypto"
+	"github.com/yellowssi/SeaStorage-TP/payload"
+	"github.com/yellowssi/SeaStorage-TP/sea"
+	"github.com/yellowssi/SeaStorage-TP/state"
+	"github.com/yellowssi/SeaStorage-TP/user"
+)
+
+func TestRanges(t *testing.T) {
+	ranges := Ranges([]uint64{5, 1, 2, 3, 7, 2})
+	if len(ranges) != 3 || ranges[0] != *sea.NewOperationRange(1, 4) || ranges[2] != *sea.NewOperationRange(7, 8) {
+		t.Errorf("invalid ranges: %v", ranges)
+	}
+	batches := SplitRanges([]sea.OperationRange{*sea.NewOperationRange(0, sea.OperationPageSize*uint64(sea.MaxConfirmPages+1))})
+	if len(batches) != 1 || len(batches[0]) != 2 || len(batches[0][0]) != sea.MaxConfirmPages {
+		t.Errorf("ranges should be split by pages: %v", batches)
+	}
+}
+
+func TestClient_Sync(t *testing.T) {
+	cont := signing.NewSecp256k1Context()
+	signer := signing.NewCryptoFactory(cont).NewSigner(cont.NewRandomPrivateKey())
+	dir, err := ioutil.TempDir("", "seaclient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := blob.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := crypto.SHA512HexFromBytes([]byte("fragment"))
+	_, err = store.Put("owner", hash, strings.NewReader("fragment"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page := sea.NewPage()
+	page.Add(sea.Operation{ID: 0, Action: sea.ActionStored, Owner: "owner", Hash: hash, Size: 8, StoredID: 1})
+	page.Add(sea.Operation{ID: 1, Action: sea.ActionUserDelete, Owner: "owner", Hash: hash, Size: 8, StoredID: 1})
+	page.Add(sea.Operation{ID: 2, Action: sea.ActionUserDelete, Owner: "owner", Hash: crypto.SHA512HexFromBytes([]byte("missing")), Size: 8})
+	var confirmed []sea.OperationRange
+	var client *Client
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/state" && r.URL.Query().Get("address") == state.MakeOperationPrefix(client.Address):
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": []map[string]string{{
+					"address": state.MakeOperationAddress(client.Address, 0),
+					"data":    base64.StdEncoding.EncodeToString(page.ToBytes()),
+				}},
+			})
+		case r.URL.Path == "/batches":
+			body, _ := ioutil.ReadAll(r.Body)
+			batchList := &batch_pb2.BatchList{}
+			err := proto.Unmarshal(body, batchList)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			for _, transaction := range batchList.Batches[0].Transactions {
+				pl, err := payload.SeaStoragePayloadFromBytes(transaction.Payload)
+				if err != nil || pl.Action != payload.SeaConfirmOperations {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				confirmed = append(confirmed, pl.OperationRanges...)
+			}
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client = NewClient(server.URL, "sea", signer, store)
+	err = client.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(confirmed) != 1 || confirmed[0] != *sea.NewOperationRange(0, 3) {
+		t.Errorf("operations should be confirmed: %v", confirmed)
+	}
+	_, err = store.Open("owner", hash)
+	if err != blob.ErrNotFound {
+		t.Error("fragment should be deleted")
+	}
+}
+
+func TestClient_VerifyPublicKey(t *testing.T) {
+	cont := signing.NewSecp256k1Context()
+	signer := signing.NewCryptoFactory(cont).NewSigner(cont.NewRandomPrivateKey())
+	publicKey := signer.GetPublicKey().AsHex()
+	address := state.MakeAddress(state.AddressTypeUser, "user", publicKey)
+	u := user.NewUser(publicKey, nil, nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/state/"+address {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"data": base64.StdEncoding.EncodeToString(u.ToBytes())})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "sea", signer, nil)
+	ok, err := client.VerifyPublicKey(address, publicKey)
+	if err != nil || !ok {
+		t.Errorf("device of user should be verified: %v", err)
+	}
+	ok, err = client.VerifyPublicKey(address, crypto.SHA256HexFromBytes([]byte("other")))
+	if err != nil || ok {
+		t.Error("key isn't device of user should be rejected")
+	}
+	ok, err = client.VerifyPublicKey(state.MakeAddress(state.AddressTypeUser, "other", publicKey), publicKey)
+	if err != nil || ok {
+		t.Error("user doesn't exist should be rejected")
+	}
+	ok, err = client.VerifyPublicKey(state.MakeAddress(state.AddressTypeGroup, "user", ""), publicKey)
+	if err != nil || ok {
+		t.Error("address isn't user should be rejected")
+	}
+}
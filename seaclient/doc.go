@@ -0,0 +1,2 @@
+// Package seaclient provides processing the operations sent to the sea for sea daemons.
+package seaclient
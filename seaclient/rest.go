@@ -0,0 +1,109 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seaclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// The response of the REST API of validator.
+type stateResponse struct {
+	Data string `json:"data"`
+}
+
+type stateListResponse struct {
+	Data []struct {
+		Address string `json:"address"`
+		Data    string `json:"data"`
+	} `json:"data"`
+	Paging struct {
+		Next string `json:"next"`
+	} `json:"paging"`
+}
+
+// errNotFound is returned when the state of address doesn't exist.
+var errNotFound = errors.New("state doesn't exist")
+
+func (c *Client) get(u string, v interface{}) error {
+	resp, err := c.HTTPClient.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request failed: %s: %s", resp.Status, body)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// Get the data of state in the address.
+func (c *Client) getState(address string) ([]byte, error) {
+	var response stateResponse
+	err := c.get(c.URL+"/state/"+address, &response)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(response.Data)
+}
+
+// List the data of states with the address prefix, the pages of response are followed.
+func (c *Client) listState(prefix string) (map[string][]byte, error) {
+	results := make(map[string][]byte)
+	next := c.URL + "/state?address=" + url.QueryEscape(prefix)
+	for next != "" {
+		var response stateListResponse
+		err := c.get(next, &response)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range response.Data {
+			data, err := base64.StdEncoding.DecodeString(entry.Data)
+			if err != nil {
+				return nil, err
+			}
+			results[entry.Address] = data
+		}
+		next = response.Paging.Next
+	}
+	return results, nil
+}
+
+// Submit the batch list to the validator.
+func (c *Client) submit(batchList []byte) error {
+	resp, err := c.HTTPClient.Post(c.URL+"/batches", "application/octet-stream", bytes.NewReader(batchList))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("failed to submit batches: %s: %s", resp.Status, body)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seaclient
+
+import (
+	"crypto/rand"
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/sawtooth-sdk-go/protobuf/batch_pb2"
+	"github.com/hyperledger/sawtooth-sdk-go/protobuf/transaction_pb2"
+	"github.com/yellowssi/SeaStorage-TP/crypto"
+	"github.com/yellowssi/SeaStorage-TP/payload"
+	"github.com/yellowssi/SeaStorage-TP/state"
+)
+
+// The family of transactions handled by the SeaStorage transaction processor.
+const (
+	FamilyName    string = "SeaStorage"
+	FamilyVersion string = "1.0"
+)
+
+// MaxBatchTransactions is the maximum count of transactions in one batch.
+const MaxBatchTransactions = 100
+
+// Generate the transaction of payload signed by the sea.
+func (c *Client) newTransaction(pl *payload.SeaStoragePayload) (*transaction_pb2.Transaction, error) {
+	plBytes := pl.ToBytes()
+	nonce := make([]byte, 16)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	publicKey := c.signer.GetPublicKey().AsHex()
+	header := &transaction_pb2.TransactionHeader{
+		FamilyName:       FamilyName,
+		FamilyVersion:    FamilyVersion,
+		Inputs:           []string{state.Namespace, state.BlockInfoNamespace, state.SettingsNamespace},
+		Outputs:          []string{state.Namespace},
+		SignerPublicKey:  publicKey,
+		BatcherPublicKey: publicKey,
+		Dependencies:     []string{},
+		PayloadSha512:    crypto.SHA512HexFromBytes(plBytes),
+		Nonce:            crypto.BytesToHex(nonce),
+	}
+	headerBytes, err := proto.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	return &transaction_pb2.Transaction{
+		Header:          headerBytes,
+		HeaderSignature: crypto.BytesToHex(c.signer.Sign(headerBytes)),
+		Payload:         plBytes,
+	}, nil
+}
+
+// Generate the batch list of transactions signed by the sea.
+func (c *Client) newBatchList(transactions []*transaction_pb2.Transaction) ([]byte, error) {
+	if len(transactions) == 0 || len(transactions) > MaxBatchTransactions {
+		return nil, errors.New("invalid count of transactions in batch")
+	}
+	ids := make([]string, 0, len(transactions))
+	for _, transaction := range transactions {
+		ids = append(ids, transaction.HeaderSignature)
+	}
+	header := &batch_pb2.BatchHeader{
+		SignerPublicKey: c.signer.GetPublicKey().AsHex(),
+		TransactionIds:  ids,
+	}
+	headerBytes, err := proto.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	batch := &batch_pb2.Batch{
+		Header:          headerBytes,
+		HeaderSignature: crypto.BytesToHex(c.signer.Sign(headerBytes)),
+		Transactions:    transactions,
+	}
+	return proto.Marshal(&batch_pb2.BatchList{Batches: []*batch_pb2.Batch{batch}})
+}
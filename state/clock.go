@@ -0,0 +1,95 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/sawtooth-sdk-go/processor"
+)
+
+// BlockInfoNamespace is the namespace of the block info transaction family.
+// The time of transaction is the timestamp of the latest block recorded in it,
+// so that every validator writes the same time into state.
+const BlockInfoNamespace = "00b10c"
+
+var blockInfoConfigAddress = BlockInfoNamespace + "01" + strings.Repeat("0", 62)
+
+func makeBlockInfoAddress(blockNum uint64) string {
+	return BlockInfoNamespace + "00" + fmt.Sprintf("%062x", blockNum)
+}
+
+// blockInfoConfig is the BlockInfoConfig message of block info transaction family.
+type blockInfoConfig struct {
+	LatestBlock   uint64 `protobuf:"varint,1,opt,name=latest_block,json=latestBlock,proto3"`
+	OldestBlock   uint64 `protobuf:"varint,2,opt,name=oldest_block,json=oldestBlock,proto3"`
+	TargetCount   uint64 `protobuf:"varint,3,opt,name=target_count,json=targetCount,proto3"`
+	SyncTolerance uint64 `protobuf:"varint,4,opt,name=sync_tolerance,json=syncTolerance,proto3"`
+}
+
+func (m *blockInfoConfig) Reset()         { *m = blockInfoConfig{} }
+func (m *blockInfoConfig) String() string { return proto.CompactTextString(m) }
+func (*blockInfoConfig) ProtoMessage()    {}
+
+// blockInfo is the BlockInfo message of block info transaction family, Timestamp is in seconds.
+type blockInfo struct {
+	BlockNum        uint64 `protobuf:"varint,1,opt,name=block_num,json=blockNum,proto3"`
+	PreviousBlockId string `protobuf:"bytes,2,opt,name=previous_block_id,json=previousBlockId,proto3"`
+	SignerPublicKey string `protobuf:"bytes,3,opt,name=signer_public_key,json=signerPublicKey,proto3"`
+	HeaderSignature string `protobuf:"bytes,4,opt,name=header_signature,json=headerSignature,proto3"`
+	Timestamp       uint64 `protobuf:"varint,5,opt,name=timestamp,proto3"`
+}
+
+func (m *blockInfo) Reset()         { *m = blockInfo{} }
+func (m *blockInfo) String() string { return proto.CompactTextString(m) }
+func (*blockInfo) ProtoMessage()    {}
+
+// Now returns the time of the latest block recorded by the block info transaction family.
+// The time must be used instead of the clock of node for anything written into state.
+func (sss *SeaStorageState) Now() (time.Time, error) {
+	if !sss.blockTime.IsZero() {
+		return sss.blockTime, nil
+	}
+	results, err := sss.context.GetState([]string{blockInfoConfigAddress})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(results[blockInfoConfigAddress]) == 0 {
+		return time.Time{}, &processor.InvalidTransactionError{Msg: "block info isn't available"}
+	}
+	config := &blockInfoConfig{}
+	err = proto.Unmarshal(results[blockInfoConfigAddress], config)
+	if err != nil {
+		return time.Time{}, &processor.InternalError{Msg: "invalid block info config"}
+	}
+	address := makeBlockInfoAddress(config.LatestBlock)
+	results, err = sss.context.GetState([]string{address})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(results[address]) == 0 {
+		return time.Time{}, &processor.InvalidTransactionError{Msg: "block info isn't available"}
+	}
+	info := &blockInfo{}
+	err = proto.Unmarshal(results[address], info)
+	if err != nil {
+		return time.Time{}, &processor.InternalError{Msg: "invalid block info"}
+	}
+	sss.blockTime = time.Unix(int64(info.Timestamp), 0)
+	return sss.blockTime, nil
+}
@@ -0,0 +1,127 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/sawtooth-sdk-go/processor"
+	"github.com/hyperledger/sawtooth-sdk-go/protobuf/setting_pb2"
+	"github.com/yellowssi/SeaStorage-TP/crypto"
+	"github.com/yellowssi/SeaStorage-TP/sea"
+)
+
+// SettingsNamespace is the namespace of the settings transaction family.
+// The consensus rules configurable by network are read from the on-chain settings.
+const SettingsNamespace = "000000"
+
+// The keys of on-chain settings.
+const (
+	// SettingTreasury is the public key allowed to deposit balance to users.
+	// If it isn't set, deposit is disabled.
+	SettingTreasury = "seastorage.treasury"
+	// SettingAcceptLegacyOperations allows the operations signed in the legacy version if it is "true".
+	SettingAcceptLegacyOperations = "seastorage.operation.accept_legacy"
+	// SettingActivityInterval is the interval in seconds to count the uptime of sea.
+	SettingActivityInterval = "seastorage.sea.activity_interval"
+	// SettingSuspectIntervals is the count of missed intervals to mark the sea as suspect.
+	SettingSuspectIntervals = "seastorage.sea.suspect_intervals"
+	// SettingOfflineIntervals is the count of missed intervals to mark the sea as offline.
+	SettingOfflineIntervals = "seastorage.sea.offline_intervals"
+)
+
+// Convert the key of setting to the address, as the settings transaction family does.
+func makeSettingAddress(key string) string {
+	parts := strings.SplitN(key, ".", 4)
+	for len(parts) < 4 {
+		parts = append(parts, "")
+	}
+	address := SettingsNamespace
+	for _, part := range parts {
+		address += crypto.SHA256HexFromBytes([]byte(part))[:16]
+	}
+	return address
+}
+
+// GetSetting returns the value of on-chain setting by the key.
+// If the setting isn't set, it returns empty string.
+func (sss *SeaStorageState) GetSetting(key string) (string, error) {
+	address := makeSettingAddress(key)
+	results, err := sss.context.GetState([]string{address})
+	if err != nil {
+		return "", err
+	}
+	if len(results[address]) == 0 {
+		return "", nil
+	}
+	setting := &setting_pb2.Setting{}
+	err = proto.Unmarshal(results[address], setting)
+	if err != nil {
+		return "", &processor.InternalError{Msg: "invalid setting: " + key}
+	}
+	for _, entry := range setting.Entries {
+		if entry.Key == key {
+			return entry.Value, nil
+		}
+	}
+	return "", nil
+}
+
+// Returns the integer value of on-chain setting, or the default value if it isn't set.
+func (sss *SeaStorageState) getIntSetting(key string, defaultValue int) (int, error) {
+	value, err := sss.GetSetting(key)
+	if err != nil {
+		return 0, err
+	}
+	if value == "" {
+		return defaultValue, nil
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &processor.InternalError{Msg: "invalid setting: " + key}
+	}
+	return result, nil
+}
+
+// Liveness returns the rule to evaluate the liveness of seas.
+// The settings not set use the default values.
+func (sss *SeaStorageState) Liveness() (sea.Liveness, error) {
+	if sss.liveness != nil {
+		return *sss.liveness, nil
+	}
+	liveness := sea.DefaultLiveness()
+	interval, err := sss.getIntSetting(SettingActivityInterval, int(sea.DefaultActivityInterval/time.Second))
+	if err != nil {
+		return liveness, err
+	}
+	liveness.ActivityInterval = time.Duration(interval) * time.Second
+	liveness.SuspectIntervals, err = sss.getIntSetting(SettingSuspectIntervals, sea.DefaultSuspectIntervals)
+	if err != nil {
+		return liveness, err
+	}
+	liveness.OfflineIntervals, err = sss.getIntSetting(SettingOfflineIntervals, sea.DefaultOfflineIntervals)
+	if err != nil {
+		return liveness, err
+	}
+	err = liveness.Validate()
+	if err != nil {
+		return liveness, &processor.InternalError{Msg: "invalid liveness settings: " + err.Error()}
+	}
+	sss.liveness = &liveness
+	return liveness, nil
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/yellowssi/SeaStorage-TP/sea"
 	"github.com/yellowssi/SeaStorage-TP/storage"
 	"github.com/yellowssi/SeaStorage-TP/user"
+	"strconv"
 	"time"
 )
 
@@ -30,6 +31,9 @@ var (
 	AddressTypeUser  AddressType = 0
 	AddressTypeGroup AddressType = 1
 	AddressTypeSea   AddressType = 2
+	AddressTypeShare AddressType = 3
+	AddressTypeIndex AddressType = 4
+	AddressTypeName  AddressType = 5
 )
 
 var (
@@ -37,6 +41,23 @@ var (
 	UserNamespace  = crypto.SHA256HexFromBytes([]byte("User"))[:4]
 	GroupNamespace = crypto.SHA256HexFromBytes([]byte("Group"))[:4]
 	SeaNamespace   = crypto.SHA256HexFromBytes([]byte("Sea"))[:4]
+	ShareNamespace = crypto.SHA256HexFromBytes([]byte("Share"))[:4]
+	IndexNamespace = crypto.SHA256HexFromBytes([]byte("Index"))[:4]
+	// NameNamespace is the namespace of the addresses of users indexed by name.
+	NameNamespace = crypto.SHA256HexFromBytes([]byte("Name"))[:4]
+	// OperationNamespace is the namespace of the pages of operations sent to seas.
+	OperationNamespace = crypto.SHA256HexFromBytes([]byte("Operation"))[:4]
+	// StoredNamespace is the namespace of the pages of fragments stored in seas.
+	StoredNamespace = crypto.SHA256HexFromBytes([]byte("Stored"))[:4]
+	// RepairNamespace is the namespace of the pages of repair tasks.
+	RepairNamespace = crypto.SHA256HexFromBytes([]byte("Repair"))[:4]
+)
+
+var (
+	// SeaIndexAddress is the address of the registry of seas.
+	SeaIndexAddress = MakeAddress(AddressTypeIndex, "Sea", "")
+	// RepairQueueAddress is the address of the queue assigning the IDs of repair tasks.
+	RepairQueueAddress = MakeAddress(AddressTypeIndex, "Repair", "")
 )
 
 type SeaStorageState struct {
@@ -44,6 +65,9 @@ type SeaStorageState struct {
 	userCache  map[string][]byte
 	groupCache map[string][]byte
 	seaCache   map[string][]byte
+	shareCache map[string][]byte
+	blockTime  time.Time     // the time of latest block, read once by Now
+	liveness   *sea.Liveness // the liveness rule of seas, read once by Liveness
 }
 
 func NewSeaStorageState(context *processor.Context) *SeaStorageState {
@@ -52,6 +76,7 @@ func NewSeaStorageState(context *processor.Context) *SeaStorageState {
 		userCache:  make(map[string][]byte),
 		groupCache: make(map[string][]byte),
 		seaCache:   make(map[string][]byte),
+		shareCache: make(map[string][]byte),
 	}
 }
 
@@ -77,16 +102,111 @@ func (sss *SeaStorageState) CreateUser(username string, publicKey string) error
 	if ok {
 		return &processor.InvalidTransactionError{Msg: "user exists"}
 	}
-	results, err := sss.context.GetState([]string{address})
+	nameAddress := MakeAddress(AddressTypeName, username, "")
+	results, err := sss.context.GetState([]string{address, nameAddress})
 	if err != nil {
 		return err
 	}
-	if len(results[address]) > 0 {
+	// The account created before the index of name has no entry in the index,
+	// it is found at the address derived from the name and public key.
+	if len(results[address]) > 0 || len(results[nameAddress]) > 0 {
 		return &processor.InvalidTransactionError{Msg: "user exists"}
 	}
+	addresses, err := sss.context.SetState(map[string][]byte{
+		nameAddress: []byte(address),
+	})
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return &processor.InternalError{Msg: "No addresses in set response"}
+	}
 	return sss.saveUser(user.GenerateUser(publicKey), address)
 }
 
+// GetUserByName returns the address and the user of name, which the public key is authorized to act on.
+// The address derived from the name and public key is checked first for the device created the account,
+// else the address is resolved by the index of name.
+func (sss *SeaStorageState) GetUserByName(username, publicKey string) (string, *user.User, error) {
+	address := MakeAddress(AddressTypeUser, username, publicKey)
+	u, err := sss.GetUser(address)
+	if err != nil {
+		nameAddress := MakeAddress(AddressTypeName, username, "")
+		results, err := sss.context.GetState([]string{nameAddress})
+		if err != nil {
+			return "", nil, err
+		}
+		if len(results[nameAddress]) == 0 {
+			return "", nil, &processor.InvalidTransactionError{Msg: "user doesn't exists"}
+		}
+		address = string(results[nameAddress])
+		u, err = sss.GetUser(address)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	if !u.VerifyPublicKey(publicKey) {
+		return "", nil, &processor.InvalidTransactionError{Msg: "device isn't authorized"}
+	}
+	return address, u, nil
+}
+
+// UserAddDevice authorize the public key of device to act on the account, signed by the existing device.
+func (sss *SeaStorageState) UserAddDevice(username, publicKey, device string) error {
+	address, u, err := sss.GetUserByName(username, publicKey)
+	if err != nil {
+		return err
+	}
+	err = u.AddDevice(device)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	err = sss.indexName(username, address)
+	if err != nil {
+		return err
+	}
+	return sss.saveUser(u, address)
+}
+
+// Write the index of name for the account created before the index,
+// so that the devices added to it can resolve the account by name.
+func (sss *SeaStorageState) indexName(username, address string) error {
+	nameAddress := MakeAddress(AddressTypeName, username, "")
+	results, err := sss.context.GetState([]string{nameAddress})
+	if err != nil {
+		return err
+	}
+	if len(results[nameAddress]) > 0 {
+		if string(results[nameAddress]) != address {
+			return &processor.InvalidTransactionError{Msg: "name is indexed to another account"}
+		}
+		return nil
+	}
+	addresses, err := sss.context.SetState(map[string][]byte{
+		nameAddress: []byte(address),
+	})
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return &processor.InternalError{Msg: "No addresses in set response"}
+	}
+	return nil
+}
+
+// UserRemoveDevice revoke the public key of device, signed by the existing device.
+func (sss *SeaStorageState) UserRemoveDevice(username, publicKey, device string) error {
+	address, u, err := sss.GetUserByName(username, publicKey)
+	if err != nil {
+		return err
+	}
+	err = u.RemoveDevice(device)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	return sss.saveUser(u, address)
+}
+
 func (sss *SeaStorageState) saveUser(u *user.User, address string) error {
 	uBytes := u.ToBytes()
 	addresses, err := sss.context.SetState(map[string][]byte{
@@ -112,13 +232,13 @@ func (sss *SeaStorageState) GetGroup(address string) (*user.Group, error) {
 		return nil, err
 	}
 	if len(results[address]) > 0 {
-		sss.seaCache[address] = results[address]
+		sss.groupCache[address] = results[address]
 		return user.GroupFromBytes(results[address])
 	}
 	return nil, &processor.InvalidTransactionError{Msg: "group doesn't exists"}
 }
 
-func (sss *SeaStorageState) CreateGroup(groupName, leader, key string) error {
+func (sss *SeaStorageState) CreateGroup(groupName, username, publicKey, key string) error {
 	address := MakeAddress(AddressTypeGroup, groupName, "")
 	_, ok := sss.groupCache[address]
 	if ok {
@@ -131,7 +251,74 @@ func (sss *SeaStorageState) CreateGroup(groupName, leader, key string) error {
 	if len(results[address]) > 0 {
 		return &processor.InvalidTransactionError{Msg: "group exists"}
 	}
-	return sss.saveGroup(user.GenerateGroup(groupName, leader), address)
+	if key == "" {
+		return &processor.InvalidTransactionError{Msg: "wrapped key of leader is nil"}
+	}
+	leader, u, err := sss.GetUserByName(username, publicKey)
+	if err != nil {
+		return err
+	}
+	u.JoinGroup(groupName)
+	err = sss.saveUser(u, leader)
+	if err != nil {
+		return err
+	}
+	return sss.saveGroup(user.GenerateGroup(groupName, leader, key), address)
+}
+
+// GroupAddMember add the user to the group with the master key wrapped by its public key.
+func (sss *SeaStorageState) GroupAddMember(groupName, username, publicKey, member, key string) error {
+	address := MakeAddress(AddressTypeGroup, groupName, "")
+	g, err := sss.GetGroup(address)
+	if err != nil {
+		return err
+	}
+	u, err := sss.GetUser(member)
+	if err != nil {
+		return err
+	}
+	actor, _, err := sss.GetUserByName(username, publicKey)
+	if err != nil {
+		return err
+	}
+	err = g.AddMember(actor, member, user.RoleDeveloper, key)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	u.JoinGroup(groupName)
+	err = sss.saveUser(u, member)
+	if err != nil {
+		return err
+	}
+	return sss.saveGroup(g, address)
+}
+
+// GroupRemoveMember remove the user from the group and rotate the master key of group.
+// The keys are the new master key wrapped for the remaining members,
+// the fileKeys are the file keys of group encrypted by the new master key.
+func (sss *SeaStorageState) GroupRemoveMember(groupName, username, publicKey, member string, keys, fileKeys map[string]string) error {
+	address := MakeAddress(AddressTypeGroup, groupName, "")
+	g, err := sss.GetGroup(address)
+	if err != nil {
+		return err
+	}
+	actor, _, err := sss.GetUserByName(username, publicKey)
+	if err != nil {
+		return err
+	}
+	err = g.RemoveMember(actor, member, keys, fileKeys)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	u, err := sss.GetUser(member)
+	if err == nil {
+		u.LeaveGroup(groupName)
+		err = sss.saveUser(u, member)
+		if err != nil {
+			return err
+		}
+	}
+	return sss.saveGroup(g, address)
 }
 
 func (sss *SeaStorageState) saveGroup(g *user.Group, address string) error {
@@ -142,7 +329,7 @@ func (sss *SeaStorageState) saveGroup(g *user.Group, address string) error {
 	if err != nil {
 		return err
 	}
-	if len(addresses) > 0 {
+	if len(addresses) == 0 {
 		return &processor.InternalError{Msg: "No addresses in set response"}
 	}
 	sss.groupCache[address] = gBytes
@@ -165,7 +352,11 @@ func (sss *SeaStorageState) GetSea(address string) (*sea.Sea, error) {
 	return nil, &processor.InvalidTransactionError{Msg: "sea doesn't exists"}
 }
 
-func (sss *SeaStorageState) CreateSea(seaName, publicKey string) error {
+func (sss *SeaStorageState) CreateSea(seaName, publicKey string, info sea.SeaInfo) error {
+	err := info.Valid()
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
 	address := MakeAddress(AddressTypeSea, seaName, publicKey)
 	_, ok := sss.seaCache[address]
 	if ok {
@@ -178,7 +369,88 @@ func (sss *SeaStorageState) CreateSea(seaName, publicKey string) error {
 	if len(results[address]) > 0 {
 		return &processor.InvalidTransactionError{Msg: "sea exists"}
 	}
-	return sss.saveSea(sea.NewSea(publicKey), address)
+	index, err := sss.GetSeaIndex()
+	if err != nil {
+		return err
+	}
+	index.Add(address)
+	s := sea.NewSea(publicKey, info)
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	liveness, err := sss.Liveness()
+	if err != nil {
+		return err
+	}
+	s.Active(now, liveness)
+	sBytes := s.ToBytes()
+	addresses, err := sss.context.SetState(map[string][]byte{
+		address:         sBytes,
+		SeaIndexAddress: index.ToBytes(),
+	})
+	if err != nil {
+		return err
+	}
+	if len(addresses) != 2 {
+		return &processor.InternalError{Msg: "failed to save data"}
+	}
+	sss.seaCache[address] = sBytes
+	return nil
+}
+
+// GetSeaIndex returns the registry of seas.
+// If there is no sea registered, it returns the empty index.
+func (sss *SeaStorageState) GetSeaIndex() (*sea.Index, error) {
+	results, err := sss.context.GetState([]string{SeaIndexAddress})
+	if err != nil {
+		return nil, err
+	}
+	if len(results[SeaIndexAddress]) > 0 {
+		return sea.IndexFromBytes(results[SeaIndexAddress])
+	}
+	return sea.NewIndex(), nil
+}
+
+func (sss *SeaStorageState) SeaUpdateInfo(seaName, publicKey string, info sea.SeaInfo) error {
+	address := MakeAddress(AddressTypeSea, seaName, publicKey)
+	s, err := sss.GetSea(address)
+	if err != nil {
+		return err
+	}
+	err = s.UpdateInfo(info)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	liveness, err := sss.Liveness()
+	if err != nil {
+		return err
+	}
+	s.Active(now, liveness)
+	return sss.saveSea(s, address)
+}
+
+// SeaHeartbeat record the sea is alive.
+func (sss *SeaStorageState) SeaHeartbeat(seaName, publicKey string) error {
+	address := MakeAddress(AddressTypeSea, seaName, publicKey)
+	s, err := sss.GetSea(address)
+	if err != nil {
+		return err
+	}
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	liveness, err := sss.Liveness()
+	if err != nil {
+		return err
+	}
+	s.Heartbeat(now, liveness)
+	return sss.saveSea(s, address)
 }
 
 func (sss *SeaStorageState) saveSea(s *sea.Sea, address string) error {
@@ -196,27 +468,204 @@ func (sss *SeaStorageState) saveSea(s *sea.Sea, address string) error {
 	return nil
 }
 
-func (sss *SeaStorageState) saveSeaOperations(address, publicKey string, data []byte, seaOperations map[string][]*sea.Operation) error {
+// Add the operations to the seas and credit the amounts due to the seas,
+// it returns the data of seas and pages should be saved.
+func (sss *SeaStorageState) addSeaOperations(owner string, seaOperations map[string][]*sea.Operation, due map[string]int64) (map[string][]byte, map[string][]byte, error) {
 	var err error
 	seaCache := make(map[string]*sea.Sea)
+	pageCache := make(map[string]*sea.Page)
+	for seaAddr, amount := range due {
+		if amount == 0 {
+			continue
+		}
+		s, err := sss.GetSea(seaAddr)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.Balance += amount
+		seaCache[seaAddr] = s
+	}
 	for seaAddr, operations := range seaOperations {
 		s, ok := seaCache[seaAddr]
 		if !ok {
 			s, err = sss.GetSea(seaAddr)
 			if err != nil {
-				return err
+				return nil, nil, err
 			}
 			seaCache[seaAddr] = s
 		}
 		for _, operation := range operations {
-			operation.Owner = publicKey
+			operation.Owner = owner
+		}
+		err = sss.addOperationPages(seaAddr, s, operations, pageCache)
+		if err != nil {
+			return nil, nil, err
 		}
-		s.AddOperation(operations)
 	}
-	cache := map[string][]byte{address: data}
+	cache := make(map[string][]byte)
 	for addr, s := range seaCache {
 		cache[addr] = s.ToBytes()
 	}
+	pages := make(map[string][]byte)
+	for addr, page := range pageCache {
+		pages[addr] = page.ToBytes()
+	}
+	return cache, pages, nil
+}
+
+// Assign the IDs to the operations and append them into the pages of the sea.
+// The pages loaded are kept in the cache.
+func (sss *SeaStorageState) addOperationPages(seaAddress string, s *sea.Sea, operations []*sea.Operation, pageCache map[string]*sea.Page) error {
+	s.AddOperation(operations)
+	for _, operation := range operations {
+		address := MakeOperationAddress(seaAddress, sea.OperationPage(operation.ID))
+		page, ok := pageCache[address]
+		if !ok {
+			var err error
+			page, err = sss.GetOperationPage(address)
+			if err != nil {
+				return err
+			}
+			pageCache[address] = page
+		}
+		page.Add(*operation)
+	}
+	return nil
+}
+
+// GetOperationPage returns the page of operations in the address.
+// If the page doesn't exist, it returns the empty page.
+func (sss *SeaStorageState) GetOperationPage(address string) (*sea.Page, error) {
+	results, err := sss.context.GetState([]string{address})
+	if err != nil {
+		return nil, err
+	}
+	if len(results[address]) > 0 {
+		return sea.PageFromBytes(results[address])
+	}
+	return sea.NewPage(), nil
+}
+
+// GetStoredPage returns the page of fragments stored in the sea in the address.
+// If the page doesn't exist, it returns the empty page.
+func (sss *SeaStorageState) GetStoredPage(address string) (*sea.StoredPage, error) {
+	results, err := sss.context.GetState([]string{address})
+	if err != nil {
+		return nil, err
+	}
+	if len(results[address]) > 0 {
+		return sea.StoredPageFromBytes(results[address])
+	}
+	return sea.NewStoredPage(), nil
+}
+
+// GetRepairPage returns the page of repair tasks in the address.
+// If the page doesn't exist, it returns the empty page.
+func (sss *SeaStorageState) GetRepairPage(address string) (*sea.RepairPage, error) {
+	results, err := sss.context.GetState([]string{address})
+	if err != nil {
+		return nil, err
+	}
+	if len(results[address]) > 0 {
+		return sea.RepairPageFromBytes(results[address])
+	}
+	return sea.NewRepairPage(), nil
+}
+
+// Returns the page of the sea storing the fragment with the id, the pages loaded are kept in the cache.
+func (sss *SeaStorageState) loadStoredPage(seaAddress string, id uint64, pageCache map[string]*sea.StoredPage) (*sea.StoredPage, error) {
+	address := MakeStoredAddress(seaAddress, sea.StoredPageNumber(id))
+	page, ok := pageCache[address]
+	if !ok {
+		var err error
+		page, err = sss.GetStoredPage(address)
+		if err != nil {
+			return nil, err
+		}
+		pageCache[address] = page
+	}
+	return page, nil
+}
+
+// Returns the page of the repair task with the id, the pages loaded are kept in the cache.
+func (sss *SeaStorageState) loadRepairPage(id uint64, pageCache map[string]*sea.RepairPage) (*sea.RepairPage, error) {
+	address := MakeRepairAddress(sea.RepairPageNumber(id))
+	page, ok := pageCache[address]
+	if !ok {
+		var err error
+		page, err = sss.GetRepairPage(address)
+		if err != nil {
+			return nil, err
+		}
+		pageCache[address] = page
+	}
+	return page, nil
+}
+
+// Put the stored pages and repair pages into the cache to save.
+// It returns the addresses of empty pages, which should be deleted.
+func collectPages(cache map[string][]byte, storedPages map[string]*sea.StoredPage, repairPages map[string]*sea.RepairPage) []string {
+	deleted := make([]string, 0)
+	for addr, page := range storedPages {
+		if len(page.Fragments) == 0 {
+			deleted = append(deleted, addr)
+		} else {
+			cache[addr] = page.ToBytes()
+		}
+	}
+	for addr, page := range repairPages {
+		if len(page.Tasks) == 0 {
+			deleted = append(deleted, addr)
+		} else {
+			cache[addr] = page.ToBytes()
+		}
+	}
+	return deleted
+}
+
+func (sss *SeaStorageState) deleteState(addresses []string) error {
+	if len(addresses) == 0 {
+		return nil
+	}
+	deleted, err := sss.context.DeleteState(addresses)
+	if err != nil {
+		return err
+	}
+	if len(deleted) != len(addresses) {
+		return &processor.InternalError{Msg: "failed to delete data"}
+	}
+	return nil
+}
+
+// Close the contracts collected before but removed from the root of user at the time of block.
+// The remaining escrow is refunded to the user, it returns the amounts due to the seas.
+func (sss *SeaStorageState) closeContracts(u *user.User, contracts []storage.StoredContract) (map[string]int64, error) {
+	now, err := sss.Now()
+	if err != nil {
+		return nil, err
+	}
+	due, refund := u.Root.CloseContracts(contracts, now)
+	if refund > 0 {
+		err = u.Deposit(refund)
+		if err != nil {
+			return nil, &processor.InvalidTransactionError{Msg: err.Error()}
+		}
+	}
+	return due, nil
+}
+
+func (sss *SeaStorageState) saveSeaOperations(address string, data []byte, seaOperations map[string][]*sea.Operation, due map[string]int64) error {
+	seaCache, pageCache, err := sss.addSeaOperations(address, seaOperations, due)
+	if err != nil {
+		return err
+	}
+	cache := map[string][]byte{address: data}
+	for addr, sBytes := range seaCache {
+		cache[addr] = sBytes
+	}
+	for addr, pBytes := range pageCache {
+		cache[addr] = pBytes
+	}
 	addresses, err := sss.context.SetState(cache)
 	if err != nil {
 		return err
@@ -224,16 +673,15 @@ func (sss *SeaStorageState) saveSeaOperations(address, publicKey string, data []
 	if len(addresses) != len(cache) {
 		return &processor.InternalError{Msg: "failed to store info"}
 	}
-	for addr, s := range seaCache {
-		sss.seaCache[addr] = s.ToBytes()
+	for addr, sBytes := range seaCache {
+		sss.seaCache[addr] = sBytes
 	}
 	sss.userCache[address] = data
 	return nil
 }
 
 func (sss *SeaStorageState) UserShareFiles(username, publicKey, p, target, dst string) error {
-	address := MakeAddress(AddressTypeUser, username, publicKey)
-	u, err := sss.GetUser(address)
+	address, u, err := sss.GetUserByName(username, publicKey)
 	if err != nil {
 		return err
 	}
@@ -241,12 +689,11 @@ func (sss *SeaStorageState) UserShareFiles(username, publicKey, p, target, dst s
 	if err != nil {
 		return &processor.InvalidTransactionError{Msg: err.Error()}
 	}
-	return sss.saveSeaOperations(address, u.PublicKey, u.ToBytes(), seaOperations)
+	return sss.saveSeaOperations(address, u.ToBytes(), seaOperations, nil)
 }
 
 func (sss *SeaStorageState) UserCreateDirectory(username, publicKey, p string) error {
-	address := MakeAddress(AddressTypeUser, username, publicKey)
-	u, err := sss.GetUser(address)
+	address, u, err := sss.GetUserByName(username, publicKey)
 	if err != nil {
 		return err
 	}
@@ -258,8 +705,7 @@ func (sss *SeaStorageState) UserCreateDirectory(username, publicKey, p string) e
 }
 
 func (sss *SeaStorageState) UserCreateFile(username, publicKey, p string, info storage.FileInfo) error {
-	address := MakeAddress(AddressTypeUser, username, publicKey)
-	u, err := sss.GetUser(address)
+	address, u, err := sss.GetUserByName(username, publicKey)
 	if err != nil {
 		return err
 	}
@@ -271,34 +717,41 @@ func (sss *SeaStorageState) UserCreateFile(username, publicKey, p string, info s
 }
 
 func (sss *SeaStorageState) UserDeleteDirectory(username, publicKey, p, target string) error {
-	address := MakeAddress(AddressTypeUser, username, publicKey)
-	u, err := sss.GetUser(address)
+	address, u, err := sss.GetUserByName(username, publicKey)
 	if err != nil {
 		return err
 	}
+	contracts := u.Root.Contracts()
 	seaOperations, err := u.Root.DeleteDirectory(p, target, true)
 	if err != nil {
 		return &processor.InvalidTransactionError{Msg: err.Error()}
 	}
-	return sss.saveSeaOperations(address, u.PublicKey, u.ToBytes(), seaOperations)
+	due, err := sss.closeContracts(u, contracts)
+	if err != nil {
+		return err
+	}
+	return sss.saveSeaOperations(address, u.ToBytes(), seaOperations, due)
 }
 
 func (sss *SeaStorageState) UserDeleteFile(username, publicKey, p, target string) error {
-	address := MakeAddress(AddressTypeUser, username, publicKey)
-	u, err := sss.GetUser(address)
+	address, u, err := sss.GetUserByName(username, publicKey)
 	if err != nil {
 		return err
 	}
+	contracts := u.Root.Contracts()
 	seaOperations, err := u.Root.DeleteFile(p, target, true)
 	if err != nil {
 		return &processor.InvalidTransactionError{Msg: err.Error()}
 	}
-	return sss.saveSeaOperations(address, u.PublicKey, u.ToBytes(), seaOperations)
+	due, err := sss.closeContracts(u, contracts)
+	if err != nil {
+		return err
+	}
+	return sss.saveSeaOperations(address, u.ToBytes(), seaOperations, due)
 }
 
 func (sss *SeaStorageState) UserMove(username, publicKey, p, name, newPath string) error {
-	address := MakeAddress(AddressTypeUser, username, publicKey)
-	u, err := sss.GetUser(address)
+	address, u, err := sss.GetUserByName(username, publicKey)
 	if err != nil {
 		return err
 	}
@@ -310,8 +763,7 @@ func (sss *SeaStorageState) UserMove(username, publicKey, p, name, newPath strin
 }
 
 func (sss *SeaStorageState) UserUpdateName(username, publicKey, p, name, newName string) error {
-	address := MakeAddress(AddressTypeUser, username, publicKey)
-	u, err := sss.GetUser(address)
+	address, u, err := sss.GetUserByName(username, publicKey)
 	if err != nil {
 		return err
 	}
@@ -323,57 +775,117 @@ func (sss *SeaStorageState) UserUpdateName(username, publicKey, p, name, newName
 }
 
 func (sss *SeaStorageState) UserUpdateFileData(username, publicKey, p string, info storage.FileInfo) error {
-	address := MakeAddress(AddressTypeUser, username, publicKey)
-	u, err := sss.GetUser(address)
+	address, u, err := sss.GetUserByName(username, publicKey)
 	if err != nil {
 		return err
 	}
+	contracts := u.Root.Contracts()
 	seaOperations, err := u.Root.UpdateFileData(p, info, true)
 	if err != nil {
 		return &processor.InvalidTransactionError{Msg: err.Error()}
 	}
-	return sss.saveSeaOperations(address, u.PublicKey, u.ToBytes(), seaOperations)
+	due, err := sss.closeContracts(u, contracts)
+	if err != nil {
+		return err
+	}
+	return sss.saveSeaOperations(address, u.ToBytes(), seaOperations, due)
 }
 
 func (sss *SeaStorageState) UserUpdateFileKey(username, publicKey, p string, info storage.FileInfo) error {
-	address := MakeAddress(AddressTypeUser, username, publicKey)
-	u, err := sss.GetUser(address)
+	address, u, err := sss.GetUserByName(username, publicKey)
 	if err != nil {
 		return err
 	}
+	contracts := u.Root.Contracts()
 	seaOperations, err := u.Root.UpdateFileKey(p, info, true)
 	if err != nil {
 		return &processor.InvalidTransactionError{Msg: err.Error()}
 	}
-	return sss.saveSeaOperations(address, u.PublicKey, u.ToBytes(), seaOperations)
+	due, err := sss.closeContracts(u, contracts)
+	if err != nil {
+		return err
+	}
+	return sss.saveSeaOperations(address, u.ToBytes(), seaOperations, due)
 }
 
-func (sss *SeaStorageState) UserPublishKey(username, publicKey, keyIndex, key string) error {
-	address := MakeAddress(AddressTypeUser, username, publicKey)
-	u, err := sss.GetUser(address)
+// UserRotateKeys change the encryption keys of files in the subtree of path at once.
+func (sss *SeaStorageState) UserRotateKeys(username, publicKey, p string, rotations []storage.KeyRotation) error {
+	address, u, err := sss.GetUserByName(username, publicKey)
+	if err != nil {
+		return err
+	}
+	contracts := u.Root.Contracts()
+	seaOperations, err := u.Root.RotateKeys(p, rotations, true)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	due, err := sss.closeContracts(u, contracts)
+	if err != nil {
+		return err
+	}
+	return sss.saveSeaOperations(address, u.ToBytes(), seaOperations, due)
+}
+
+// UserPublishKey publish the key of user.
+// If the recipient is empty, the plaintext key is published to everyone,
+// else the key encrypted by the public key of recipient is published to it.
+func (sss *SeaStorageState) UserPublishKey(username, publicKey, keyIndex, recipient, key string) error {
+	address, u, err := sss.GetUserByName(username, publicKey)
 	if err != nil {
 		return err
 	}
-	err = u.Root.PublishKey(publicKey, keyIndex, key)
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	if recipient == "" {
+		err = u.Root.PublishKey(publicKey, keyIndex, key, now)
+	} else {
+		err = u.Root.PublishKeyTo(publicKey, keyIndex, recipient, key, now)
+	}
 	if err != nil {
 		return &processor.InvalidTransactionError{Msg: err.Error()}
 	}
 	return sss.saveUser(u, address)
 }
 
-func (sss *SeaStorageState) SeaStoreFile(seaName, publicKey string, operations []user.Operation) error {
+// SeaStoreFile record the fragments stored by the sea.
+// The merkle roots are computed by the sea from the fragments received, in the order of operations,
+// so that the owner can't register a bogus root to fail the challenges of the sea.
+func (sss *SeaStorageState) SeaStoreFile(seaName, publicKey string, operations []user.Operation, merkleRoots []string) error {
+	if len(merkleRoots) != len(operations) {
+		return &processor.InvalidTransactionError{Msg: "merkle roots should be confirmed for every operation"}
+	}
 	seaAddress := MakeAddress(AddressTypeSea, seaName, publicKey)
 	s, err := sss.GetSea(seaAddress)
 	if err != nil {
 		return err
 	}
+	if s.Decommissioning {
+		return &processor.InvalidTransactionError{Msg: "sea is decommissioning"}
+	}
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	liveness, err := sss.Liveness()
+	if err != nil {
+		return err
+	}
+	s.Active(now, liveness)
+	acceptLegacy, err := sss.GetSetting(SettingAcceptLegacyOperations)
+	if err != nil {
+		return err
+	}
 	userCache := make(map[string]*user.User)
-	for _, operation := range operations {
+	storedPages := make(map[string]*sea.StoredPage)
+	storedOperations := make([]*sea.Operation, 0, len(operations))
+	for i, operation := range operations {
 		if operation.Sea != publicKey {
 			return &processor.InvalidTransactionError{Msg: "invalid operation"}
 		}
 		timestamp := time.Unix(operation.Timestamp, 0)
-		if !operation.Verify() || timestamp.Before(time.Now()) {
+		if !operation.Verify(acceptLegacy == "true") || timestamp.Before(now) {
 			return &processor.InvalidTransactionError{Msg: "invalid operation"}
 		}
 		u, ok := userCache[operation.Address]
@@ -387,17 +899,68 @@ func (sss *SeaStorageState) SeaStoreFile(seaName, publicKey string, operations [
 		if !u.VerifyPublicKey(operation.PublicKey) {
 			return &processor.InvalidTransactionError{Msg: "signature is invalid"}
 		}
-		err = u.Root.AddSea(operation.Path, operation.Name, operation.Hash, storage.NewFragmentSea(seaAddress, publicKey, timestamp))
+		err = u.ConsumeOperation(&operation, now)
+		if err != nil {
+			return &processor.InvalidTransactionError{Msg: err.Error()}
+		}
+		fragment, err := u.Root.GetFragment(operation.Path, operation.Name, operation.Hash)
+		if err != nil {
+			return &processor.InvalidTransactionError{Msg: err.Error()}
+		}
+		if fragment.Size != operation.Size {
+			return &processor.InvalidTransactionError{Msg: "size of fragment mismatch"}
+		}
+		if fragment.MerkleRoot != merkleRoots[i] {
+			return &processor.InvalidTransactionError{Msg: "merkle root of fragment mismatch"}
+		}
+		fragmentSea := storage.NewFragmentSea(seaAddress, publicKey, timestamp)
+		fragmentSea.Weight = s.Weight()
+		info, err := u.Root.GetFile(operation.Path, operation.Name)
+		if err != nil {
+			return &processor.InvalidTransactionError{Msg: err.Error()}
+		}
+		fragmentSea.Contract, err = storage.NewContract(operation.Size, s.Price, now, info.RetentionDuration())
+		if err != nil {
+			return &processor.InvalidTransactionError{Msg: err.Error()}
+		}
+		fragmentSea.Expiry = fragmentSea.Contract.End
+		err = u.Pay(fragmentSea.Contract.Escrow)
+		if err != nil {
+			return &processor.InvalidTransactionError{Msg: err.Error()}
+		}
+		stored := sea.StoredFragment{Owner: operation.Address, Hash: operation.Hash, Size: operation.Size}
+		s.AddStored(&stored)
+		fragmentSea.StoredID = stored.ID
+		err = u.Root.AddSea(operation.Path, operation.Name, operation.Hash, fragmentSea)
+		if err != nil {
+			return &processor.InvalidTransactionError{Msg: err.Error()}
+		}
+		err = s.Reserve(operation.Size)
 		if err != nil {
 			return &processor.InvalidTransactionError{Msg: err.Error()}
 		}
+		page, err := sss.loadStoredPage(seaAddress, stored.ID, storedPages)
+		if err != nil {
+			return err
+		}
+		page.Add(stored)
+		storedOperations = append(storedOperations, sea.NewStoredOperation(stored))
 		s.Handles++
 	}
+	pageCache := make(map[string]*sea.Page)
+	err = sss.addOperationPages(seaAddress, s, storedOperations, pageCache)
+	if err != nil {
+		return err
+	}
 	cache := make(map[string][]byte)
 	cache[seaAddress] = s.ToBytes()
 	for address, u := range userCache {
 		cache[address] = u.ToBytes()
 	}
+	for address, page := range pageCache {
+		cache[address] = page.ToBytes()
+	}
+	collectPages(cache, storedPages, nil)
 	addresses, err := sss.context.SetState(cache)
 	if err != nil {
 		return err
@@ -412,25 +975,784 @@ func (sss *SeaStorageState) SeaStoreFile(seaName, publicKey string, operations [
 	return nil
 }
 
-func (sss *SeaStorageState) SeaConfirmOperations(seaName, publicKey string, operations []sea.Operation) error {
+// SeaConfirmOperations remove the operations in the ranges of IDs confirmed by the sea.
+// The empty pages are deleted.
+func (sss *SeaStorageState) SeaConfirmOperations(seaName, publicKey string, ranges []sea.OperationRange) error {
 	address := MakeAddress(AddressTypeSea, seaName, publicKey)
 	s, err := sss.GetSea(address)
 	if err != nil {
 		return err
 	}
-	s.RemoveOperations(operations)
-	return sss.saveSea(s, address)
+	err = s.ValidRanges(ranges)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	cache := make(map[string][]byte)
+	deleted := make([]string, 0)
+	storedPages := make(map[string]*sea.StoredPage)
+	repairPages := make(map[string]*sea.RepairPage)
+	for _, number := range sea.OperationPages(ranges) {
+		pageAddress := MakeOperationAddress(address, number)
+		page, err := sss.GetOperationPage(pageAddress)
+		if err != nil {
+			return err
+		}
+		removed := page.Remove(ranges)
+		if len(removed) == 0 {
+			continue
+		}
+		// The records of deleted fragments are removed with their repair tasks, and their space is released.
+		for _, operation := range s.Confirm(removed) {
+			storedPage, err := sss.loadStoredPage(address, operation.StoredID, storedPages)
+			if err != nil {
+				return err
+			}
+			stored := s.RemoveStored(storedPage, operation.StoredID, operation.Owner, operation.Hash)
+			if stored == nil || !stored.Repairing {
+				continue
+			}
+			repairPage, err := sss.loadRepairPage(stored.TaskID, repairPages)
+			if err != nil {
+				return err
+			}
+			repairPage.Remove(stored.TaskID)
+		}
+		if len(page.Operations) == 0 {
+			deleted = append(deleted, pageAddress)
+		} else {
+			cache[pageAddress] = page.ToBytes()
+		}
+	}
+	deleted = append(deleted, collectPages(cache, storedPages, repairPages)...)
+	err = sss.deleteState(deleted)
+	if err != nil {
+		return err
+	}
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	liveness, err := sss.Liveness()
+	if err != nil {
+		return err
+	}
+	s.Active(now, liveness)
+	if s.Retired() {
+		if len(cache) > 0 {
+			addresses, err := sss.context.SetState(cache)
+			if err != nil {
+				return err
+			}
+			if len(addresses) != len(cache) {
+				return &processor.InternalError{Msg: "failed to save data"}
+			}
+		}
+		return sss.deleteSea(address)
+	}
+	sBytes := s.ToBytes()
+	cache[address] = sBytes
+	addresses, err := sss.context.SetState(cache)
+	if err != nil {
+		return err
+	}
+	if len(addresses) != len(cache) {
+		return &processor.InternalError{Msg: "failed to save data"}
+	}
+	sss.seaCache[address] = sBytes
+	return nil
 }
 
-func MakeAddress(addressType AddressType, name, publicKey string) string {
-	switch addressType {
-	case AddressTypeUser:
-		return Namespace + UserNamespace + crypto.SHA512HexFromBytes(bytes.Join([][]byte{[]byte(name), crypto.HexToBytes(publicKey)}, []byte{}))[:60]
-	case AddressTypeGroup:
-		return Namespace + GroupNamespace + crypto.SHA512HexFromBytes([]byte(name))[:60]
-	case AddressTypeSea:
-		return Namespace + SeaNamespace + crypto.SHA512HexFromBytes(bytes.Join([][]byte{[]byte(name), crypto.HexToBytes(publicKey)}, []byte{}))[:60]
-	default:
-		return ""
+// UserChallengeSea challenge the sea to prove it stores the fragment of file.
+// The same fragment can't be challenged again in the cooldown.
+// The expired challenges of the sea are recorded as failures.
+func (sss *SeaStorageState) UserChallengeSea(username, publicKey, p, name, hash, seaAddress, seed string) error {
+	address, u, err := sss.GetUserByName(username, publicKey)
+	if err != nil {
+		return err
+	}
+	fragment, err := u.Root.GetFragment(p, name, hash)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	if fragment.MerkleRoot == "" {
+		return &processor.InvalidTransactionError{Msg: "fragment has no merkle root"}
+	}
+	fragmentSea, err := fragment.GetSea(seaAddress)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	s, err := sss.GetSea(seaAddress)
+	if err != nil {
+		return err
+	}
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	err = fragmentSea.Challenge(now)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	expired := s.ExpireChallenges(now)
+	challenge := sea.NewChallenge(seed, address, hash, fragment.MerkleRoot, fragment.Size, crypto.HexToBytes(seed), now.Add(sea.ChallengeTimeout))
+	err = s.AddChallenge(challenge)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	// The user is saved first, so that the weights updated by the expired challenges are kept.
+	err = sss.saveUser(u, address)
+	if err != nil {
+		return err
+	}
+	return sss.saveSeaReputation(seaAddress, s, expired)
+}
+
+// SeaRespondChallenge verify the proofs of the challenge responded by the sea.
+// The invalid proofs are recorded as failure instead of rejecting the transaction.
+func (sss *SeaStorageState) SeaRespondChallenge(seaName, publicKey, id string, proofs []crypto.MerkleProof) error {
+	address := MakeAddress(AddressTypeSea, seaName, publicKey)
+	s, err := sss.GetSea(address)
+	if err != nil {
+		return err
+	}
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	liveness, err := sss.Liveness()
+	if err != nil {
+		return err
+	}
+	s.Active(now, liveness)
+	challenge, _, err := s.RespondChallenge(id, proofs, now)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	challenges := append(s.ExpireChallenges(now), *challenge)
+	return sss.saveSeaReputation(address, s, challenges)
+}
+
+// Save the sea and update its weight in the files of challenges' owners.
+func (sss *SeaStorageState) saveSeaReputation(address string, s *sea.Sea, challenges []sea.Challenge) error {
+	var err error
+	userCache := make(map[string]*user.User)
+	for _, challenge := range challenges {
+		u, ok := userCache[challenge.Owner]
+		if !ok {
+			u, err = sss.GetUser(challenge.Owner)
+			if err != nil {
+				return err
+			}
+			userCache[challenge.Owner] = u
+		}
+		u.Root.UpdateSeaWeight(address, challenge.Hash, s.Weight())
+	}
+	cache := map[string][]byte{address: s.ToBytes()}
+	for addr, u := range userCache {
+		cache[addr] = u.ToBytes()
+	}
+	addresses, err := sss.context.SetState(cache)
+	if err != nil {
+		return err
+	}
+	if len(addresses) != len(cache) {
+		return &processor.InternalError{Msg: "failed to save data"}
+	}
+	for addr, data := range cache {
+		if addr == address {
+			sss.seaCache[addr] = data
+		} else {
+			sss.userCache[addr] = data
+		}
 	}
+	return nil
+}
+
+// GetRepairQueue returns the queue assigning the IDs of repair tasks.
+// If there is no repair task, it returns the empty queue.
+func (sss *SeaStorageState) GetRepairQueue() (*sea.RepairQueue, error) {
+	results, err := sss.context.GetState([]string{RepairQueueAddress})
+	if err != nil {
+		return nil, err
+	}
+	if len(results[RepairQueueAddress]) > 0 {
+		return sea.RepairQueueFromBytes(results[RepairQueueAddress])
+	}
+	return sea.NewRepairQueue(), nil
+}
+
+// CreateRepairTasks add the repair tasks of fragments in the page stored in the offline, unreliable or decommissioning sea.
+// The tasks are created page by page, so that the work of transaction is bounded.
+func (sss *SeaStorageState) CreateRepairTasks(seaAddress string, page uint64) error {
+	s, err := sss.GetSea(seaAddress)
+	if err != nil {
+		return err
+	}
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	liveness, err := sss.Liveness()
+	if err != nil {
+		return err
+	}
+	if !s.Decommissioning && !s.NeedRepair(now, liveness) {
+		return &processor.InvalidTransactionError{Msg: "sea doesn't need repair"}
+	}
+	storedAddress := MakeStoredAddress(seaAddress, page)
+	storedPage, err := sss.GetStoredPage(storedAddress)
+	if err != nil {
+		return err
+	}
+	rq, err := sss.GetRepairQueue()
+	if err != nil {
+		return err
+	}
+	tasks := rq.AddTasks(seaAddress, storedPage)
+	if len(tasks) == 0 {
+		return &processor.InvalidTransactionError{Msg: "no fragment to repair"}
+	}
+	repairPages := make(map[string]*sea.RepairPage)
+	for _, task := range tasks {
+		repairPage, err := sss.loadRepairPage(task.ID, repairPages)
+		if err != nil {
+			return err
+		}
+		repairPage.Add(task)
+	}
+	cache := map[string][]byte{
+		RepairQueueAddress: rq.ToBytes(),
+		storedAddress:      storedPage.ToBytes(),
+	}
+	collectPages(cache, nil, repairPages)
+	addresses, err := sss.context.SetState(cache)
+	if err != nil {
+		return err
+	}
+	if len(addresses) != len(cache) {
+		return &processor.InternalError{Msg: "failed to save data"}
+	}
+	return nil
+}
+
+// SeaClaimRepair assign the repair task to the healthy sea.
+func (sss *SeaStorageState) SeaClaimRepair(seaName, publicKey string, id uint64) error {
+	address := MakeAddress(AddressTypeSea, seaName, publicKey)
+	s, err := sss.GetSea(address)
+	if err != nil {
+		return err
+	}
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	liveness, err := sss.Liveness()
+	if err != nil {
+		return err
+	}
+	if s.Decommissioning || s.Status(now, liveness) != sea.StatusOnline || s.NeedRepair(now, liveness) {
+		return &processor.InvalidTransactionError{Msg: "sea isn't healthy"}
+	}
+	repairAddress := MakeRepairAddress(sea.RepairPageNumber(id))
+	repairPage, err := sss.GetRepairPage(repairAddress)
+	if err != nil {
+		return err
+	}
+	task, err := repairPage.Claim(id, address, now)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	if s.Free() < task.Size {
+		return &processor.InvalidTransactionError{Msg: "sea hasn't enough free space"}
+	}
+	u, err := sss.GetUser(task.Owner)
+	if err != nil {
+		return err
+	}
+	err = u.Root.CheckSeaAvailable(publicKey, task.Hash)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	addresses, err := sss.context.SetState(map[string][]byte{
+		repairAddress: repairPage.ToBytes(),
+	})
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return &processor.InternalError{Msg: "No addresses in set response"}
+	}
+	return nil
+}
+
+// SeaCompleteRepair replace the failed sea with the sea stored the fragment of the repair task.
+// The sea confirms the merkle root of fragment it stored as SeaStoreFile does.
+// The delete operation is sent to the failed sea, in case of it comes back.
+func (sss *SeaStorageState) SeaCompleteRepair(seaName, publicKey string, id uint64, merkleRoot string) error {
+	address := MakeAddress(AddressTypeSea, seaName, publicKey)
+	s, err := sss.GetSea(address)
+	if err != nil {
+		return err
+	}
+	repairPages := make(map[string]*sea.RepairPage)
+	repairPage, err := sss.loadRepairPage(id, repairPages)
+	if err != nil {
+		return err
+	}
+	task, err := repairPage.Complete(id, address)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	source, err := sss.GetSea(task.Source)
+	if err != nil {
+		return err
+	}
+	u, err := sss.GetUser(task.Owner)
+	if err != nil {
+		return err
+	}
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	liveness, err := sss.Liveness()
+	if err != nil {
+		return err
+	}
+	s.Active(now, liveness)
+	stored := sea.StoredFragment{Owner: task.Owner, Hash: task.Hash, Size: task.Size}
+	s.AddStored(&stored)
+	fragmentSea := storage.NewFragmentSea(address, publicKey, now)
+	fragmentSea.Weight = s.Weight()
+	fragmentSea.StoredID = stored.ID
+	err = u.Root.ReplaceSea(task.Source, task.StoredID, task.Hash, merkleRoot, fragmentSea, now)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	err = s.Reserve(task.Size)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	storedPages := make(map[string]*sea.StoredPage)
+	storedPage, err := sss.loadStoredPage(address, stored.ID, storedPages)
+	if err != nil {
+		return err
+	}
+	storedPage.Add(stored)
+	s.Handles++
+	pageCache := make(map[string]*sea.Page)
+	err = sss.addOperationPages(address, s, []*sea.Operation{sea.NewStoredOperation(stored)}, pageCache)
+	if err != nil {
+		return err
+	}
+	cache := map[string][]byte{
+		task.Owner: u.ToBytes(),
+		address:    s.ToBytes(),
+	}
+	if source.Decommissioning {
+		// The decommissioning sea drops its data after leaving, so the record is removed directly.
+		sourcePage, err := sss.loadStoredPage(task.Source, task.StoredID, storedPages)
+		if err != nil {
+			return err
+		}
+		source.RemoveStored(sourcePage, task.StoredID, task.Owner, task.Hash)
+	} else {
+		// The record is removed and the space is released when the sea confirms the delete operation.
+		operation := sea.NewOperation(sea.ActionUserDelete, task.Owner, task.Hash, task.Size, false)
+		operation.StoredID = task.StoredID
+		err = sss.addOperationPages(task.Source, source, []*sea.Operation{operation}, pageCache)
+		if err != nil {
+			return err
+		}
+	}
+	for addr, page := range pageCache {
+		cache[addr] = page.ToBytes()
+	}
+	if !source.Retired() {
+		cache[task.Source] = source.ToBytes()
+	}
+	err = sss.deleteState(collectPages(cache, storedPages, repairPages))
+	if err != nil {
+		return err
+	}
+	addresses, err := sss.context.SetState(cache)
+	if err != nil {
+		return err
+	}
+	if len(addresses) != len(cache) {
+		return &processor.InternalError{Msg: "failed to save data"}
+	}
+	sss.userCache[task.Owner] = cache[task.Owner]
+	sss.seaCache[address] = cache[address]
+	if source.Retired() {
+		return sss.deleteSea(task.Source)
+	}
+	sss.seaCache[task.Source] = cache[task.Source]
+	return nil
+}
+
+// SweepExpired delete the expired files of user and send the delete operations to seas.
+func (sss *SeaStorageState) SweepExpired(address string) error {
+	u, err := sss.GetUser(address)
+	if err != nil {
+		return err
+	}
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	contracts := u.Root.Contracts()
+	seaOperations, count := u.Root.SweepExpired(now, true)
+	if count == 0 {
+		return &processor.InvalidTransactionError{Msg: "no file is expired"}
+	}
+	due, err := sss.closeContracts(u, contracts)
+	if err != nil {
+		return err
+	}
+	return sss.saveSeaOperations(address, u.ToBytes(), seaOperations, due)
+}
+
+// UserRenewFile extend the retention of file, the cost of extended contracts is paid by user.
+func (sss *SeaStorageState) UserRenewFile(username, publicKey, p, name string, retention int64) error {
+	address, u, err := sss.GetUserByName(username, publicKey)
+	if err != nil {
+		return err
+	}
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	cost, err := u.Root.RenewFile(p, name, time.Duration(retention)*time.Second, now)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	err = u.Pay(cost)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	return sss.saveUser(u, address)
+}
+
+// TreasuryDeposit add the amount to the balance of user.
+// The transaction should be signed by the treasury.
+func (sss *SeaStorageState) TreasuryDeposit(publicKey, address string, amount int64) error {
+	treasury, err := sss.GetSetting(SettingTreasury)
+	if err != nil {
+		return err
+	}
+	if treasury == "" || publicKey != treasury {
+		return &processor.InvalidTransactionError{Msg: "deposit isn't signed by treasury"}
+	}
+	u, err := sss.GetUser(address)
+	if err != nil {
+		return err
+	}
+	err = u.Deposit(amount)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	return sss.saveUser(u, address)
+}
+
+// SeaSettle settle the storage contracts between the owner and the sea,
+// the amount due is moved from the escrow of owner to the balance of sea.
+func (sss *SeaStorageState) SeaSettle(seaName, publicKey, owner string) error {
+	address := MakeAddress(AddressTypeSea, seaName, publicKey)
+	s, err := sss.GetSea(address)
+	if err != nil {
+		return err
+	}
+	u, err := sss.GetUser(owner)
+	if err != nil {
+		return err
+	}
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	amount := u.Root.Settle(address, now)
+	if amount == 0 {
+		return &processor.InvalidTransactionError{Msg: "nothing to settle"}
+	}
+	s.Balance += amount
+	liveness, err := sss.Liveness()
+	if err != nil {
+		return err
+	}
+	s.Active(now, liveness)
+	uBytes := u.ToBytes()
+	sBytes := s.ToBytes()
+	addresses, err := sss.context.SetState(map[string][]byte{
+		owner:   uBytes,
+		address: sBytes,
+	})
+	if err != nil {
+		return err
+	}
+	if len(addresses) != 2 {
+		return &processor.InternalError{Msg: "failed to save data"}
+	}
+	sss.userCache[owner] = uBytes
+	sss.seaCache[address] = sBytes
+	return nil
+}
+
+// SeaDecommission announce the sea is leaving the network.
+// The fragments stored in the sea are migrated to other seas by repair tasks created page by page,
+// the sea is removed once all fragments are migrated.
+func (sss *SeaStorageState) SeaDecommission(seaName, publicKey string) error {
+	address := MakeAddress(AddressTypeSea, seaName, publicKey)
+	s, err := sss.GetSea(address)
+	if err != nil {
+		return err
+	}
+	err = s.Decommission()
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	if s.Retired() {
+		return sss.deleteSea(address)
+	}
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	liveness, err := sss.Liveness()
+	if err != nil {
+		return err
+	}
+	s.Active(now, liveness)
+	sBytes := s.ToBytes()
+	addresses, err := sss.context.SetState(map[string][]byte{
+		address: sBytes,
+	})
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return &processor.InternalError{Msg: "No addresses in set response"}
+	}
+	sss.seaCache[address] = sBytes
+	return nil
+}
+
+// Remove the retired sea from the registry.
+// The retired sea doesn't store any fragment, so there is no stored page or repair task left.
+func (sss *SeaStorageState) deleteSea(address string) error {
+	index, err := sss.GetSeaIndex()
+	if err != nil {
+		return err
+	}
+	index.Remove(address)
+	addresses, err := sss.context.SetState(map[string][]byte{SeaIndexAddress: index.ToBytes()})
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return &processor.InternalError{Msg: "No addresses in set response"}
+	}
+	addresses, err = sss.context.DeleteState([]string{address})
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return &processor.InternalError{Msg: "No addresses in delete response"}
+	}
+	delete(sss.seaCache, address)
+	return nil
+}
+
+func (sss *SeaStorageState) GetShareLink(address string) (*storage.ShareLink, error) {
+	linkBytes, ok := sss.shareCache[address]
+	if ok {
+		return storage.ShareLinkFromBytes(linkBytes)
+	}
+	results, err := sss.context.GetState([]string{address})
+	if err != nil {
+		return nil, err
+	}
+	if len(results[address]) > 0 {
+		sss.shareCache[address] = results[address]
+		return storage.ShareLinkFromBytes(results[address])
+	}
+	return nil, &processor.InvalidTransactionError{Msg: "share link doesn't exists"}
+}
+
+func (sss *SeaStorageState) saveShareLink(link *storage.ShareLink, address string) error {
+	linkBytes := link.ToBytes()
+	addresses, err := sss.context.SetState(map[string][]byte{
+		address: linkBytes,
+	})
+	if err != nil {
+		return err
+	}
+	if len(addresses) == 0 {
+		return &processor.InternalError{Msg: "No addresses in set response"}
+	}
+	sss.shareCache[address] = linkBytes
+	return nil
+}
+
+func (sss *SeaStorageState) UserCreateShareLink(username, publicKey, p, name string, info storage.ShareLinkInfo) error {
+	address, u, err := sss.GetUserByName(username, publicKey)
+	if err != nil {
+		return err
+	}
+	linkAddress := MakeAddress(AddressTypeShare, "", info.PublicKey)
+	_, ok := sss.shareCache[linkAddress]
+	if ok {
+		return &processor.InvalidTransactionError{Msg: "share link exists"}
+	}
+	results, err := sss.context.GetState([]string{linkAddress})
+	if err != nil {
+		return err
+	}
+	if len(results[linkAddress]) > 0 {
+		return &processor.InvalidTransactionError{Msg: "share link exists"}
+	}
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	link, seaOperations, err := u.Root.CreateShareLink(address, p, name, info, now, true)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	return sss.saveShareLinkOperations(address, linkAddress, link, seaOperations)
+}
+
+// Save the share link with the operations sent to seas by the owner.
+// If the link is nil, it is revoked and deleted from state.
+func (sss *SeaStorageState) saveShareLinkOperations(owner, linkAddress string, link *storage.ShareLink, seaOperations map[string][]*sea.Operation) error {
+	seaCache, pageCache, err := sss.addSeaOperations(owner, seaOperations, nil)
+	if err != nil {
+		return err
+	}
+	cache := make(map[string][]byte)
+	if link != nil {
+		cache[linkAddress] = link.ToBytes()
+	}
+	for addr, sBytes := range seaCache {
+		cache[addr] = sBytes
+	}
+	for addr, pBytes := range pageCache {
+		cache[addr] = pBytes
+	}
+	if len(cache) > 0 {
+		addresses, err := sss.context.SetState(cache)
+		if err != nil {
+			return err
+		}
+		if len(addresses) != len(cache) {
+			return &processor.InternalError{Msg: "failed to save data"}
+		}
+	}
+	for addr, sBytes := range seaCache {
+		sss.seaCache[addr] = sBytes
+	}
+	if link == nil {
+		addresses, err := sss.context.DeleteState([]string{linkAddress})
+		if err != nil {
+			return err
+		}
+		if len(addresses) == 0 {
+			return &processor.InternalError{Msg: "No addresses in delete response"}
+		}
+		delete(sss.shareCache, linkAddress)
+		return nil
+	}
+	sss.shareCache[linkAddress] = cache[linkAddress]
+	return nil
+}
+
+// UserRevokeShareLink delete the share link and the seas stop sharing its fragments.
+func (sss *SeaStorageState) UserRevokeShareLink(username, publicKey, linkPublicKey string) error {
+	address, _, err := sss.GetUserByName(username, publicKey)
+	if err != nil {
+		return err
+	}
+	linkAddress := MakeAddress(AddressTypeShare, "", linkPublicKey)
+	link, err := sss.GetShareLink(linkAddress)
+	if err != nil {
+		return err
+	}
+	if link.Owner != address {
+		return &processor.InvalidTransactionError{Msg: "share link isn't owned by user"}
+	}
+	seaOperations := make(map[string][]*sea.Operation)
+	if !link.Exhausted() {
+		// The seas stopped sharing the exhausted link already.
+		seaOperations = link.UnshareOperations(true)
+	}
+	return sss.saveShareLinkOperations(address, linkAddress, nil, seaOperations)
+}
+
+// ResolveShareLink count the download of share link.
+// The seas stop sharing the fragments when the link reaches the download limit.
+// The transaction should be signed by the private key of share link.
+func (sss *SeaStorageState) ResolveShareLink(linkPublicKey string) error {
+	linkAddress := MakeAddress(AddressTypeShare, "", linkPublicKey)
+	link, err := sss.GetShareLink(linkAddress)
+	if err != nil {
+		return err
+	}
+	now, err := sss.Now()
+	if err != nil {
+		return err
+	}
+	exhausted, err := link.Resolve(now)
+	if err != nil {
+		return &processor.InvalidTransactionError{Msg: err.Error()}
+	}
+	if exhausted {
+		return sss.saveShareLinkOperations(link.Owner, linkAddress, link, link.UnshareOperations(true))
+	}
+	return sss.saveShareLink(link, linkAddress)
+}
+
+func MakeAddress(addressType AddressType, name, publicKey string) string {
+	switch addressType {
+	case AddressTypeUser:
+		return Namespace + UserNamespace + crypto.SHA512HexFromBytes(bytes.Join([][]byte{[]byte(name), crypto.HexToBytes(publicKey)}, []byte{}))[:60]
+	case AddressTypeGroup:
+		return Namespace + GroupNamespace + crypto.SHA512HexFromBytes([]byte(name))[:60]
+	case AddressTypeSea:
+		return Namespace + SeaNamespace + crypto.SHA512HexFromBytes(bytes.Join([][]byte{[]byte(name), crypto.HexToBytes(publicKey)}, []byte{}))[:60]
+	case AddressTypeShare:
+		return Namespace + ShareNamespace + crypto.SHA512HexFromHex(publicKey)[:60]
+	case AddressTypeIndex:
+		return Namespace + IndexNamespace + crypto.SHA512HexFromBytes([]byte(name))[:60]
+	case AddressTypeName:
+		return Namespace + NameNamespace + crypto.SHA512HexFromBytes([]byte(name))[:60]
+	default:
+		return ""
+	}
+}
+
+// MakeOperationPrefix returns the prefix of addresses of the pages of operations sent to the sea,
+// so that the sea can list its pages.
+func MakeOperationPrefix(seaAddress string) string {
+	return Namespace + OperationNamespace + crypto.SHA512HexFromBytes([]byte(seaAddress))[:30]
+}
+
+// MakeOperationAddress returns the address of the page of operations sent to the sea.
+func MakeOperationAddress(seaAddress string, page uint64) string {
+	return MakeOperationPrefix(seaAddress) + crypto.SHA512HexFromBytes([]byte(strconv.FormatUint(page, 10)))[:30]
+}
+
+// MakeStoredPrefix returns the prefix of addresses of the pages of fragments stored in the sea.
+func MakeStoredPrefix(seaAddress string) string {
+	return Namespace + StoredNamespace + crypto.SHA512HexFromBytes([]byte(seaAddress))[:30]
+}
+
+// MakeStoredAddress returns the address of the page of fragments stored in the sea.
+func MakeStoredAddress(seaAddress string, page uint64) string {
+	return MakeStoredPrefix(seaAddress) + crypto.SHA512HexFromBytes([]byte(strconv.FormatUint(page, 10)))[:30]
+}
+
+// MakeRepairAddress returns the address of the page of repair tasks,
+// the seas can list the pages by the prefix of RepairNamespace.
+func MakeRepairAddress(page uint64) string {
+	return Namespace + RepairNamespace + crypto.SHA512HexFromBytes([]byte(strconv.FormatUint(page, 10)))[:60]
 }
@@ -1,6 +1,7 @@
 package state
 
 import (
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/sawtooth-sdk-go/signing"
 	"testing"
 )
@@ -34,3 +35,62 @@ func TestBytesOr(t *testing.T) {
 	t.Log(GroupNamespace)
 	t.Log(SeaNamespace)
 }
+
+func TestMakeOperationAddress(t *testing.T) {
+	seaAddress := MakeAddress(AddressTypeSea, "Test", "02")
+	address := MakeOperationAddress(seaAddress, 1)
+	if len(address) != 70 || address[:40] != MakeOperationPrefix(seaAddress) {
+		t.Error("invalid address of operation page")
+	}
+	t.Log(address)
+}
+
+func TestMakeStoredAddress(t *testing.T) {
+	seaAddress := MakeAddress(AddressTypeSea, "Test", "02")
+	address := MakeStoredAddress(seaAddress, 1)
+	if len(address) != 70 || address[:40] != MakeStoredPrefix(seaAddress) {
+		t.Error("invalid address of stored page")
+	}
+	if len(MakeRepairAddress(1)) != 70 {
+		t.Error("invalid address of repair page")
+	}
+	for _, namespace := range []string{UserNamespace, GroupNamespace, SeaNamespace, ShareNamespace, IndexNamespace, NameNamespace, OperationNamespace} {
+		if namespace == StoredNamespace || namespace == RepairNamespace {
+			t.Error("namespace of pages conflicts")
+		}
+	}
+}
+
+func TestMakeNameAddress(t *testing.T) {
+	address := MakeAddress(AddressTypeName, "Test", "")
+	if len(address) != 70 || address[6:10] != NameNamespace {
+		t.Error("invalid address of name index")
+	}
+	for _, namespace := range []string{UserNamespace, GroupNamespace, SeaNamespace, ShareNamespace, IndexNamespace, OperationNamespace} {
+		if namespace == NameNamespace {
+			t.Error("namespace of name index conflicts")
+		}
+	}
+}
+
+func TestBlockInfo(t *testing.T) {
+	if len(blockInfoConfigAddress) != 70 || len(makeBlockInfoAddress(10)) != 70 {
+		t.Error("invalid address of block info")
+	}
+	data, err := proto.Marshal(&blockInfo{BlockNum: 10, PreviousBlockId: "id", Timestamp: 1500000000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &blockInfo{}
+	err = proto.Unmarshal(data, info)
+	if err != nil || info.BlockNum != 10 || info.Timestamp != 1500000000 {
+		t.Error("block info should be decoded", err)
+	}
+}
+
+func TestMakeSettingAddress(t *testing.T) {
+	address := makeSettingAddress("sawtooth.settings.vote.authorized_keys")
+	if address != "000000a87cb5eafdcca6a8cde0fb0dec1400c5ab274474a6aa82c12840f169a04216b7" {
+		t.Error("invalid address of setting:", address)
+	}
+}
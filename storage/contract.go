@@ -0,0 +1,176 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"errors"
+	"math/big"
+	"time"
+)
+
+// ContractDuration is the duration of storage contract created when the fragment is stored in the sea.
+const ContractDuration = 30 * 24 * time.Hour
+
+// The price of sea is per GB-month.
+const (
+	contractGigabyte = 1 << 30
+	contractMonth    = 30 * 24 * 60 * 60
+)
+
+// Contract is the storage contract between the owner and the sea storing the fragment.
+// The cost of whole duration is prepaid by the owner into Escrow,
+// and it is settled to the sea by the time elapsed.
+// If the fragment is removed before the end of contract, the cost until the removal is settled to the sea
+// and the remaining escrow is refunded to the owner.
+type Contract struct {
+	Size    int64
+	Price   int64 // per GB-month
+	Start   int64
+	End     int64
+	Settled int64 // the time settled up to
+	Escrow  int64 // the prepaid balance not settled yet
+}
+
+// NewContract is the construct for Contract.
+// The escrow is the cost of whole duration, it returns the error if the cost overflows.
+func NewContract(size, price int64, start time.Time, duration time.Duration) (*Contract, error) {
+	c := &Contract{
+		Size:    size,
+		Price:   price,
+		Start:   start.Unix(),
+		End:     start.Add(duration).Unix(),
+		Settled: start.Unix(),
+	}
+	cost := c.cost(c.End)
+	if !cost.IsInt64() {
+		return nil, errors.New("cost of contract overflows")
+	}
+	c.Escrow = cost.Int64()
+	return c, nil
+}
+
+// Transfer returns the contract for the sea replacing the sea of contract at the time.
+// The new contract starts from the time to the end of contract with the escrow not settled yet,
+// so the replaced sea isn't paid for the time after it failed.
+func (c *Contract) Transfer(now time.Time) *Contract {
+	start := now.Unix()
+	settled := start
+	if start >= c.End {
+		// The escrow of contract already ended is settled at once.
+		start = c.End
+		settled = c.Settled
+	}
+	return &Contract{
+		Size:    c.Size,
+		Price:   c.Price,
+		Start:   start,
+		End:     c.End,
+		Settled: settled,
+		Escrow:  c.Escrow,
+	}
+}
+
+// The cost from the start of contract to the time.
+// Big integer is used to avoid overflow, and the result is rounded down.
+func (c *Contract) cost(until int64) *big.Int {
+	if until <= c.Start {
+		return big.NewInt(0)
+	}
+	cost := big.NewInt(c.Size)
+	cost.Mul(cost, big.NewInt(c.Price))
+	cost.Mul(cost, big.NewInt(until-c.Start))
+	return cost.Quo(cost, big.NewInt(contractGigabyte*contractMonth))
+}
+
+// Expired returns whether the contract is ended at the time.
+func (c *Contract) Expired(now time.Time) bool {
+	return now.Unix() >= c.End
+}
+
+// Settle returns the amount due to the sea from the last settlement to the time, and deduct it from escrow.
+// The remaining escrow is settled when the contract is ended.
+func (c *Contract) Settle(now time.Time) int64 {
+	until := now.Unix()
+	if until >= c.End {
+		until = c.End
+	}
+	if until <= c.Settled {
+		return 0
+	}
+	// The cost until the end doesn't overflow, as it is checked when the contract is created.
+	due := new(big.Int).Sub(c.cost(until), c.cost(c.Settled)).Int64()
+	if until == c.End || due > c.Escrow {
+		due = c.Escrow
+	}
+	c.Escrow -= due
+	c.Settled = until
+	return due
+}
+
+// StoredContract is the contract of the sea storing the fragment by the record with StoredID.
+type StoredContract struct {
+	Address  string
+	StoredID uint64
+	Contract *Contract
+}
+
+// Collect the contracts of seas storing the fragments in the directory recursively.
+func (d *Directory) collectContracts(contracts []StoredContract) []StoredContract {
+	for _, iNode := range d.INodes {
+		switch iNode.(type) {
+		case *Directory:
+			contracts = iNode.(*Directory).collectContracts(contracts)
+		case *File:
+			for _, fragment := range iNode.(*File).Fragments {
+				for _, s := range fragment.Seas {
+					if s.Contract != nil {
+						contracts = append(contracts, StoredContract{Address: s.Address, StoredID: s.StoredID, Contract: s.Contract})
+					}
+				}
+			}
+		}
+	}
+	return contracts
+}
+
+// Contracts returns the contracts of seas storing the fragments of files in 'home' directory.
+// It should be collected before the fragments are removed, so that the removed contracts can be closed.
+func (root *Root) Contracts() []StoredContract {
+	return root.Home.collectContracts(make([]StoredContract, 0))
+}
+
+// CloseContracts settle the contracts collected before but removed from 'home' directory at the time.
+// It returns the amounts due to the seas by address and the remaining escrow refunded to the owner.
+func (root *Root) CloseContracts(contracts []StoredContract, now time.Time) (map[string]int64, int64) {
+	type key struct {
+		address  string
+		storedID uint64
+	}
+	remained := make(map[key]bool)
+	for _, c := range root.Contracts() {
+		remained[key{c.Address, c.StoredID}] = true
+	}
+	due := make(map[string]int64)
+	var refund int64
+	for _, c := range contracts {
+		if remained[key{c.Address, c.StoredID}] {
+			continue
+		}
+		due[c.Address] += c.Contract.Settle(now)
+		refund += c.Contract.Escrow
+		c.Contract.Escrow = 0
+	}
+	return due, refund
+}
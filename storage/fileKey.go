@@ -3,14 +3,33 @@ package storage
 import (
 	"errors"
 	"github.com/yellowssi/SeaStorage-TP/crypto"
+	"sort"
+	"time"
 )
 
 // FileKey store the information of key used to encrypt file.
+// Key is the private or encrypted form kept by the owner,
+// the key released by publishing is stored in Publication or Recipients.
 type FileKey struct {
-	Index     string
-	Used      int
+	Index       string
+	Used        int
+	Key         string
+	Published   bool
+	Publication *KeyPublication // plaintext key released to everyone
+	Recipients  []KeyRecipient  // sorted by recipient
+}
+
+// KeyPublication is the record of key released by the publisher.
+type KeyPublication struct {
 	Key       string
-	Published bool
+	Publisher string // publisher public key
+	Timestamp int64
+}
+
+// KeyRecipient is the key encrypted by the public key of recipient.
+type KeyRecipient struct {
+	Recipient   string // recipient public key
+	Publication KeyPublication
 }
 
 // FileKeyMap provides file keys manage.
@@ -35,17 +54,16 @@ func (fkm *FileKeyMap) GetKey(index string) *FileKey {
 	return nil
 }
 
-// AddKey add new information of key.
-// If used, the used count of key will be 1.
-// Else, it will be 0.
-func (fkm *FileKeyMap) AddKey(key string, used bool) string {
-	index := crypto.SHA512HexFromHex(key)
+// AddKey add new information of key by the index of plaintext key.
+// If the index exists, the key stored before is kept.
+// If used, the used count of key will be increased.
+func (fkm *FileKeyMap) AddKey(index, key string, used bool) {
 	for _, fileKey := range fkm.Keys {
 		if fileKey.Index == index {
 			if used {
 				fileKey.Used++
 			}
-			return index
+			return
 		}
 	}
 	var fileKey *FileKey
@@ -55,7 +73,6 @@ func (fkm *FileKeyMap) AddKey(key string, used bool) string {
 		fileKey = &FileKey{Index: index, Key: key, Used: 0}
 	}
 	fkm.Keys = append(fkm.Keys, fileKey)
-	return index
 }
 
 // UpdateKeyUsed update used count of keys by index and count.
@@ -80,13 +97,82 @@ func (fkm *FileKeyMap) UpdateKeyUsed(keyUsed map[string]int) {
 	}
 }
 
-// PublishKey check key whether valid and publish it.
-func (fkm *FileKeyMap) PublishKey(publicKey, keyIndex, key string) error {
+// ReplaceKeys replace the keys by index, all keys should be provided.
+// It is used when the key encrypting the file keys rotated.
+func (fkm *FileKeyMap) ReplaceKeys(keys map[string]string) error {
+	if len(keys) != len(fkm.Keys) {
+		return errors.New("all keys should be replaced")
+	}
+	for _, fileKey := range fkm.Keys {
+		if keys[fileKey.Index] == "" {
+			return errors.New("key isn't replaced: " + fileKey.Index)
+		}
+	}
+	for _, fileKey := range fkm.Keys {
+		fileKey.Key = keys[fileKey.Index]
+	}
+	return nil
+}
+
+// PublishKey release the plaintext key so that anyone shared can decrypt the file.
+// The key should match the index, the private form of key is kept.
+func (fkm *FileKeyMap) PublishKey(publicKey, keyIndex, key string, now time.Time) error {
+	fileKey := fkm.GetKey(keyIndex)
+	if fileKey == nil {
+		return errors.New("key doesn't exists")
+	}
+	if fileKey.Publication != nil {
+		return errors.New("key is published")
+	}
+	if len(crypto.HexToBytes(key)) == 0 || crypto.SHA512HexFromHex(key) != keyIndex {
+		return errors.New("key doesn't match the index")
+	}
+	fileKey.Publication = &KeyPublication{Key: key, Publisher: publicKey, Timestamp: now.Unix()}
+	fileKey.Published = true
+	return nil
+}
+
+// PublishKeyTo release the key encrypted by the public key of recipient.
+// The encrypted key can't be verified, the recipient should check it after decryption.
+func (fkm *FileKeyMap) PublishKeyTo(publicKey, keyIndex, recipient, key string, now time.Time) error {
 	fileKey := fkm.GetKey(keyIndex)
-	if fileKey != nil {
-		fileKey.Key = key
-		fileKey.Published = true
+	if fileKey == nil {
+		return errors.New("key doesn't exists")
+	}
+	if recipient == "" {
+		return errors.New("recipient shouldn't be nil")
+	}
+	if key == "" {
+		return errors.New("key shouldn't be nil")
+	}
+	publication := KeyPublication{Key: key, Publisher: publicKey, Timestamp: now.Unix()}
+	i := fileKey.searchRecipient(recipient)
+	if i < len(fileKey.Recipients) && fileKey.Recipients[i].Recipient == recipient {
+		fileKey.Recipients[i].Publication = publication
 		return nil
 	}
-	return errors.New("invalid key or not exists")
+	fileKey.Recipients = append(fileKey.Recipients, KeyRecipient{})
+	copy(fileKey.Recipients[i+1:], fileKey.Recipients[i:])
+	fileKey.Recipients[i] = KeyRecipient{Recipient: recipient, Publication: publication}
+	return nil
+}
+
+// Returns the position of recipient in the sorted recipients.
+func (fk *FileKey) searchRecipient(recipient string) int {
+	return sort.Search(len(fk.Recipients), func(i int) bool {
+		return fk.Recipients[i].Recipient >= recipient
+	})
+}
+
+// PublishedKey returns the key released to the recipient.
+// The plaintext key is returned if it is published to everyone.
+func (fk *FileKey) PublishedKey(recipient string) (*KeyPublication, error) {
+	if fk.Publication != nil {
+		return fk.Publication, nil
+	}
+	i := fk.searchRecipient(recipient)
+	if i == len(fk.Recipients) || fk.Recipients[i].Recipient != recipient {
+		return nil, errors.New("key isn't published to the recipient")
+	}
+	return &fk.Recipients[i].Publication, nil
 }
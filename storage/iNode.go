@@ -19,13 +19,18 @@ import (
 	"encoding/gob"
 	"encoding/json"
 	"errors"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/yellowssi/SeaStorage-TP/erasure"
 	"github.com/yellowssi/SeaStorage-TP/sea"
 )
 
+// MaxReplicas is the maximum count of seas storing the same fragment.
+const MaxReplicas = 8
+
 type INode interface {
 	GetName() string
 	GetSize() int64
@@ -45,6 +50,8 @@ type File struct {
 	Hash      string
 	KeyIndex  string
 	Fragments []*Fragment
+	Coding    Coding
+	Retention int64 // seconds, 0 means ContractDuration
 }
 
 type Directory struct {
@@ -55,17 +62,32 @@ type Directory struct {
 	INodes []INode
 }
 
+// Fragment is the piece of file stored in seas.
+// MerkleRoot is the root of Merkle tree over the segments of fragment, used to challenge seas.
 type Fragment struct {
-	Hash string
-	Size int64
-	Seas []*FragmentSea
+	Hash       string
+	Size       int64
+	MerkleRoot string
+	Seas       []*FragmentSea
+}
+
+// Coding is the erasure coding parameters of file.
+// The fragments of erasure coded file are data shards followed by parity shards.
+// If DataShards is 0, the file isn't erasure coded and the fragments are replicated.
+type Coding struct {
+	DataShards   int
+	ParityShards int
 }
 
 type FragmentSea struct {
-	Address   string
-	PublicKey string
-	Weight    int8
-	Timestamp time.Time
+	Address        string
+	PublicKey      string
+	Weight         int8
+	Timestamp      time.Time
+	Contract       *Contract
+	Expiry         int64  // unix time, 0 means never expires
+	StoredID       uint64 // the ID of fragment in the stored pages of the sea
+	LastChallenged int64  // unix time the sea was challenged for the fragment last, 0 means never
 }
 
 type INodeInfo struct {
@@ -74,8 +96,8 @@ type INodeInfo struct {
 	Size  int64
 }
 
-func NewFile(name string, size int64, hash string, key string, fragments []*Fragment) *File {
-	return &File{Name: name, Size: size, Hash: hash, KeyIndex: key, Fragments: fragments}
+func NewFile(name string, size int64, hash string, key string, fragments []*Fragment, coding Coding, retention int64) *File {
+	return &File{Name: name, Size: size, Hash: hash, KeyIndex: key, Fragments: fragments, Coding: coding, Retention: retention}
 }
 
 func NewDirectory(name string) *Directory {
@@ -90,6 +112,45 @@ func NewFragmentSea(address, publicKey string, timestamp time.Time) *FragmentSea
 	return &FragmentSea{Address: address, PublicKey: publicKey, Weight: 0, Timestamp: timestamp}
 }
 
+// Erasure returns whether the file is erasure coded.
+func (c Coding) Erasure() bool {
+	return c.DataShards > 0
+}
+
+// Check the fragments submitted by user.
+// The seas are only added by the seas storing or repairing the fragments, so that the contracts can't be forged.
+func validFragments(fragments []*Fragment) error {
+	for _, fragment := range fragments {
+		if fragment == nil {
+			return errors.New("fragment shouldn't be nil")
+		}
+		if len(fragment.Seas) > 0 {
+			return errors.New("seas of fragment should be added by the seas storing it: " + fragment.Hash)
+		}
+	}
+	return nil
+}
+
+// Check the coding whether valid for the count of fragments.
+func (c Coding) valid(fragments int) error {
+	if !c.Erasure() {
+		if c.ParityShards != 0 {
+			return errors.New("invalid coding: data shards should be positive")
+		}
+		return nil
+	}
+	if c.ParityShards < 0 {
+		return errors.New("invalid coding: parity shards shouldn't be negative")
+	}
+	if c.DataShards+c.ParityShards > erasure.MaxShards {
+		return errors.New("invalid coding: too many shards")
+	}
+	if c.DataShards+c.ParityShards != fragments {
+		return errors.New("invalid coding: count of fragments doesn't match shards")
+	}
+	return nil
+}
+
 func (f *File) lock() {
 	f.mutex.Lock()
 }
@@ -322,7 +383,7 @@ func (d *Directory) DeleteDirectory(p, name string, userOrGroup, shared bool) (s
 }
 
 // Store the file into the path.
-func (d *Directory) CreateFile(p, name, hash, keyHash string, size int64, fragments []*Fragment) error {
+func (d *Directory) CreateFile(p, name, hash, keyHash string, size int64, fragments []*Fragment, coding Coding, retention int64) error {
 	dir, err := d.checkPathExists(p)
 	if err != nil {
 		return err
@@ -334,30 +395,30 @@ func (d *Directory) CreateFile(p, name, hash, keyHash string, size int64, fragme
 	}
 	d.lock()
 	defer d.unlock()
-	dir.INodes = append(dir.INodes, NewFile(name, size, hash, keyHash, fragments))
+	dir.INodes = append(dir.INodes, NewFile(name, size, hash, keyHash, fragments, coding, retention))
 	return nil
 }
 
 // Update the data of file finding by the filename and the path of file.
-func (d *Directory) UpdateFileData(p, name, hash string, size int64, fragments []*Fragment, userOrGroup, shared bool) (map[string][]*sea.Operation, error) {
+func (d *Directory) UpdateFileData(p, name, hash string, size int64, fragments []*Fragment, coding Coding, userOrGroup, shared bool) (map[string][]*sea.Operation, error) {
 	file, err := d.checkFileExists(p, name)
 	if err != nil {
 		return nil, err
 	}
 	file.lock()
 	defer file.unlock()
-	return d.updateFileData(file, hash, size, fragments, userOrGroup, shared), nil
+	return d.updateFileData(file, hash, size, fragments, coding, userOrGroup, shared), nil
 }
 
 // Update the Key of file
-func (d *Directory) UpdateFileKey(p, name, keyIndex, hash string, size int64, fragments []*Fragment, userOrGroup, shared bool) (map[string]int, map[string][]*sea.Operation, error) {
+func (d *Directory) UpdateFileKey(p, name, keyIndex, hash string, size int64, fragments []*Fragment, coding Coding, userOrGroup, shared bool) (map[string]int, map[string][]*sea.Operation, error) {
 	file, err := d.checkFileExists(p, name)
 	if err != nil {
 		return nil, nil, err
 	}
 	file.lock()
 	defer file.unlock()
-	seaOperations := d.updateFileData(file, hash, size, fragments, userOrGroup, shared)
+	seaOperations := d.updateFileData(file, hash, size, fragments, coding, userOrGroup, shared)
 	keyUsed := make(map[string]int)
 	keyUsed[file.KeyIndex]--
 	file.KeyIndex = keyIndex
@@ -365,7 +426,7 @@ func (d *Directory) UpdateFileKey(p, name, keyIndex, hash string, size int64, fr
 	return keyUsed, seaOperations, nil
 }
 
-func (d *Directory) updateFileData(file *File, hash string, size int64, fragments []*Fragment, userOrGroup, shared bool) map[string][]*sea.Operation {
+func (d *Directory) updateFileData(file *File, hash string, size int64, fragments []*Fragment, coding Coding, userOrGroup, shared bool) map[string][]*sea.Operation {
 	var seaOperations map[string][]*sea.Operation
 	if userOrGroup {
 		seaOperations = file.GenerateSeaOperations(sea.ActionUserDelete, shared)
@@ -375,6 +436,7 @@ func (d *Directory) updateFileData(file *File, hash string, size int64, fragment
 	file.Size = size
 	file.Hash = hash
 	file.Fragments = fragments
+	file.Coding = coding
 	return seaOperations
 }
 
@@ -435,6 +497,18 @@ func (d Directory) AddSea(p, name, hash string, sea *FragmentSea) error {
 	}
 	file.lock()
 	defer file.unlock()
+	if file.Coding.Erasure() {
+		for _, fragment := range file.Fragments {
+			if fragment.Hash == hash {
+				continue
+			}
+			for _, s := range fragment.Seas {
+				if s.PublicKey == sea.PublicKey {
+					return errors.New("sea stores another shard of file")
+				}
+			}
+		}
+	}
 	for _, fragment := range file.Fragments {
 		if fragment.Hash == hash {
 			for _, s := range fragment.Seas {
@@ -442,6 +516,9 @@ func (d Directory) AddSea(p, name, hash string, sea *FragmentSea) error {
 					return errors.New("fragment stored")
 				}
 			}
+			if len(fragment.Seas) >= MaxReplicas {
+				return errors.New("fragment reached the maximum replicas")
+			}
 			fragment.Seas = append(fragment.Seas, sea)
 			return nil
 		}
@@ -449,6 +526,159 @@ func (d Directory) AddSea(p, name, hash string, sea *FragmentSea) error {
 	return errors.New("fragment is not valid")
 }
 
+// GetFragment returns the fragment of file by its hash.
+func (f *File) GetFragment(hash string) (*Fragment, error) {
+	for _, fragment := range f.Fragments {
+		if fragment.Hash == hash {
+			return fragment, nil
+		}
+	}
+	return nil, errors.New("fragment is not valid")
+}
+
+// GetSea returns the information of sea storing the fragment.
+func (f *Fragment) GetSea(address string) (*FragmentSea, error) {
+	for _, s := range f.Seas {
+		if s.Address == address {
+			return s, nil
+		}
+	}
+	return nil, errors.New("fragment isn't stored in sea: " + address)
+}
+
+// Challenge record the sea is challenged to prove the fragment at the time.
+// It returns the error if the sea was challenged in the cooldown.
+func (s *FragmentSea) Challenge(now time.Time) error {
+	if s.LastChallenged != 0 && now.Before(time.Unix(s.LastChallenged, 0).Add(sea.ChallengeCooldown)) {
+		return errors.New("fragment is challenged in the cooldown")
+	}
+	s.LastChallenged = now.Unix()
+	return nil
+}
+
+// PreferredSeas returns the seas storing the fragment sorted by weight, the higher weight is preferred to download.
+func (f *Fragment) PreferredSeas() []*FragmentSea {
+	seas := make([]*FragmentSea, len(f.Seas))
+	copy(seas, f.Seas)
+	sort.SliceStable(seas, func(i, j int) bool {
+		return seas[i].Weight > seas[j].Weight
+	})
+	return seas
+}
+
+// Walk the fragments with the hash in the directory recursively.
+func (d *Directory) walkFragments(hash string, fn func(file *File, fragment *Fragment)) {
+	for _, iNode := range d.INodes {
+		switch iNode.(type) {
+		case *Directory:
+			iNode.(*Directory).walkFragments(hash, fn)
+		case *File:
+			file := iNode.(*File)
+			for _, fragment := range file.Fragments {
+				if fragment.Hash == hash {
+					fn(file, fragment)
+				}
+			}
+		}
+	}
+}
+
+// Update the weight of sea storing the fragment with the hash in the directory recursively.
+// It returns the count of fragments updated.
+func (d *Directory) updateSeaWeight(address, hash string, weight int8) int {
+	count := 0
+	d.walkFragments(hash, func(file *File, fragment *Fragment) {
+		for _, s := range fragment.Seas {
+			if s.Address == address {
+				s.Weight = weight
+				count++
+			}
+		}
+	})
+	return count
+}
+
+// Check the sea with the public key whether can store the fragment with the hash in the directory recursively.
+// The seas are identified by the public key as AddSea does.
+func (d *Directory) checkSeaAvailable(publicKey, hash string) error {
+	var err error
+	d.walkFragments(hash, func(file *File, fragment *Fragment) {
+		for _, f := range file.Fragments {
+			if f != fragment && !file.Coding.Erasure() {
+				continue
+			}
+			for _, s := range f.Seas {
+				if s.PublicKey == publicKey && err == nil {
+					if f == fragment {
+						err = errors.New("fragment stored")
+					} else {
+						err = errors.New("sea stores another shard of file")
+					}
+				}
+			}
+		}
+	})
+	return err
+}
+
+// Find the fragment with the hash stored in the sea by the record with the id in the directory recursively.
+func (d *Directory) findStored(address string, storedID uint64, hash string) *Fragment {
+	var result *Fragment
+	d.walkFragments(hash, func(file *File, fragment *Fragment) {
+		for _, s := range fragment.Seas {
+			if s.Address == address && s.StoredID == storedID && result == nil {
+				result = fragment
+			}
+		}
+	})
+	return result
+}
+
+// Replace the sea storing the fragment with the hash in the directory recursively.
+// Only the sea storing the record with the id is replaced, the same fragment of other files is stored by other records.
+// The contract not settled and the expiry are transferred to the new sea at the time.
+// It returns the count of fragments updated.
+func (d *Directory) replaceSea(address string, storedID uint64, hash string, sea *FragmentSea, now time.Time) int {
+	count := 0
+	d.walkFragments(hash, func(file *File, fragment *Fragment) {
+		for i, s := range fragment.Seas {
+			if s.Address == address && s.StoredID == storedID {
+				fragmentSea := *sea
+				if fragmentSea.Contract == nil && s.Contract != nil {
+					fragmentSea.Contract = s.Contract.Transfer(now)
+				}
+				if fragmentSea.Expiry == 0 {
+					fragmentSea.Expiry = s.Expiry
+				}
+				fragment.Seas[i] = &fragmentSea
+				count++
+			}
+		}
+	})
+	return count
+}
+
+// Settle the contracts of the sea in the directory recursively.
+// It returns the amount due to the sea.
+func (d *Directory) settle(address string, now time.Time) int64 {
+	var amount int64
+	for _, iNode := range d.INodes {
+		switch iNode.(type) {
+		case *Directory:
+			amount += iNode.(*Directory).settle(address, now)
+		case *File:
+			for _, fragment := range iNode.(*File).Fragments {
+				for _, s := range fragment.Seas {
+					if s.Address == address && s.Contract != nil {
+						amount += s.Contract.Settle(now)
+					}
+				}
+			}
+		}
+	}
+	return amount
+}
+
 // List information of INodes in the path.
 func (d *Directory) List(p string) ([]INodeInfo, error) {
 	dir, err := d.checkPathExists(p)
@@ -485,7 +715,9 @@ func (f *File) GenerateSeaOperations(action uint, shared bool) map[string][]*sea
 	seaOperations := make(map[string][]*sea.Operation)
 	for _, fragment := range f.Fragments {
 		for _, fragmentSea := range fragment.Seas {
-			seaOperations[fragmentSea.Address] = append(seaOperations[fragmentSea.Address], &sea.Operation{Action: action, Hash: fragment.Hash, Shared: shared})
+			operation := sea.NewOperation(action, "", fragment.Hash, fragment.Size, shared)
+			operation.StoredID = fragmentSea.StoredID
+			seaOperations[fragmentSea.Address] = append(seaOperations[fragmentSea.Address], operation)
 		}
 	}
 	return seaOperations
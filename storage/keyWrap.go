@@ -0,0 +1,69 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+
+	"github.com/yellowssi/SeaStorage-TP/crypto"
+)
+
+// Check the wrapped key and the index of key in file info whether valid.
+// The chain can't verify that the wrapped key is the plaintext key matching the index,
+// because the plaintext key isn't stored in state, the owner should check it after unwrapping.
+// So the index stored before can only be reused with the same wrapped key,
+// otherwise the files sharing the index would be decrypted by a different key.
+func validKey(info FileInfo, keys *FileKeyMap) error {
+	if info.Key == "" {
+		return errors.New("key of file shouldn't be nil")
+	}
+	index, err := hex.DecodeString(info.KeyIndex)
+	if err != nil || len(index) != sha512.Size {
+		return errors.New("invalid key index: " + info.KeyIndex)
+	}
+	fileKey := keys.GetKey(info.KeyIndex)
+	if fileKey != nil && fileKey.Key != info.Key {
+		return errors.New("key index exists with different key: " + info.KeyIndex)
+	}
+	return nil
+}
+
+// WrapKey wrap the plaintext key of file info by the owner public key.
+// The key index is derived from the plaintext key, so that the same key is deduplicated.
+func (info *FileInfo) WrapKey(publicKey string) error {
+	wrapped, err := crypto.Encryption(publicKey, info.Key)
+	if err != nil {
+		return err
+	}
+	info.KeyIndex = crypto.SHA512HexFromHex(info.Key)
+	info.Key = crypto.BytesToHex(wrapped)
+	return nil
+}
+
+// UnwrapKey unwrap the key of file info by the owner private key.
+// It returns the error if the plaintext key doesn't match the key index.
+func (info *FileInfo) UnwrapKey(privateKey string) error {
+	key, err := crypto.Decryption(privateKey, info.Key)
+	if err != nil {
+		return err
+	}
+	if crypto.SHA512HexFromBytes(key) != info.KeyIndex {
+		return errors.New("key doesn't match the index")
+	}
+	info.Key = crypto.BytesToHex(key)
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/yellowssi/SeaStorage-TP/sea"
+)
+
+// SweepGrace is the duration after the expiry of file before it can be swept,
+// so that the seas can settle the contracts ended.
+const SweepGrace = 24 * time.Hour
+
+func retentionDuration(retention int64) time.Duration {
+	if retention > 0 {
+		return time.Duration(retention) * time.Second
+	}
+	return ContractDuration
+}
+
+// RetentionDuration returns the duration the file declared to be stored in seas.
+func (info FileInfo) RetentionDuration() time.Duration {
+	return retentionDuration(info.Retention)
+}
+
+// RetentionDuration returns the duration the file declared to be stored in seas.
+func (f *File) RetentionDuration() time.Duration {
+	return retentionDuration(f.Retention)
+}
+
+// Expired returns whether all seas storing the file are expired at the time.
+// The file not stored in any sea or stored without expiry never expires.
+func (f *File) Expired(now time.Time) bool {
+	stored := false
+	for _, fragment := range f.Fragments {
+		for _, s := range fragment.Seas {
+			if s.Expiry == 0 || s.Expiry > now.Unix() {
+				return false
+			}
+			stored = true
+		}
+	}
+	return stored
+}
+
+// Extend the contract by the duration.
+// It returns the cost of extended duration, which is added to escrow.
+// The contract isn't extended if the cost overflows.
+func (c *Contract) Extend(duration time.Duration) (int64, error) {
+	end := c.End + int64(duration/time.Second)
+	total := c.cost(end)
+	if !total.IsInt64() {
+		return 0, errors.New("cost of contract overflows")
+	}
+	cost := total.Sub(total, c.cost(c.End)).Int64()
+	if c.Escrow+cost < c.Escrow {
+		return 0, errors.New("cost of contract overflows")
+	}
+	c.End = end
+	c.Escrow += cost
+	return cost, nil
+}
+
+// Remove the expired files in the directory recursively and update the size of directories.
+// The delete operations of seas and the usage of keys are collected.
+func (d *Directory) sweepExpired(now time.Time, userOrGroup bool, seaOperations map[string][]*sea.Operation, keyUsed map[string]int) int {
+	count := 0
+	d.lock()
+	defer d.unlock()
+	iNodes := make([]INode, 0, len(d.INodes))
+	d.Size = 0
+	for _, iNode := range d.INodes {
+		switch iNode.(type) {
+		case *Directory:
+			count += iNode.(*Directory).sweepExpired(now, userOrGroup, seaOperations, keyUsed)
+		case *File:
+			file := iNode.(*File)
+			if file.Expired(now.Add(-SweepGrace)) {
+				var operations map[string][]*sea.Operation
+				if userOrGroup {
+					operations = file.GenerateSeaOperations(sea.ActionUserDelete, false)
+				} else {
+					operations = file.GenerateSeaOperations(sea.ActionGroupDelete, false)
+				}
+				for addr, ops := range operations {
+					seaOperations[addr] = append(seaOperations[addr], ops...)
+				}
+				keyUsed[file.KeyIndex]--
+				count++
+				continue
+			}
+		}
+		iNodes = append(iNodes, iNode)
+		d.Size += iNode.GetSize()
+	}
+	d.INodes = iNodes
+	return count
+}
+
+// SweepExpired delete the files in 'home' directory expired for the grace at the time.
+// It returns the delete operations of seas and the count of files deleted.
+func (root *Root) SweepExpired(now time.Time, userOrGroup bool) (map[string][]*sea.Operation, int) {
+	seaOperations := make(map[string][]*sea.Operation)
+	keyUsed := make(map[string]int)
+	count := root.Home.sweepExpired(now, userOrGroup, seaOperations, keyUsed)
+	root.Keys.UpdateKeyUsed(keyUsed)
+	return seaOperations, count
+}
+
+// RenewFile extend the expiry and contracts of seas storing the file by the duration.
+// The expired file can't be renewed, it returns the cost of extended contracts.
+func (root *Root) RenewFile(p, name string, duration time.Duration, now time.Time) (int64, error) {
+	err := validInfo(p, name)
+	if err != nil {
+		return 0, err
+	}
+	if duration <= 0 {
+		return 0, errors.New("duration of renewal should be positive")
+	}
+	f, err := root.Home.checkFileExists(p, name)
+	if err != nil {
+		return 0, err
+	}
+	if f.Expired(now) {
+		return 0, errors.New("file is expired")
+	}
+	var cost int64
+	renewed := false
+	for _, fragment := range f.Fragments {
+		for _, s := range fragment.Seas {
+			if s.Expiry == 0 {
+				continue
+			}
+			s.Expiry += int64(duration / time.Second)
+			if s.Contract != nil {
+				extended, err := s.Contract.Extend(duration)
+				if err != nil {
+					return 0, err
+				}
+				if cost+extended < cost {
+					return 0, errors.New("cost of renewal overflows")
+				}
+				cost += extended
+			}
+			renewed = true
+		}
+	}
+	if !renewed {
+		return 0, errors.New("file isn't stored with expiry")
+	}
+	return cost, nil
+}
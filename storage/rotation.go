@@ -0,0 +1,100 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/yellowssi/SeaStorage-TP/sea"
+)
+
+// KeyRotation is the new key and data of the file in the path.
+type KeyRotation struct {
+	Path string
+	Info FileInfo
+}
+
+// RotateKeys change the encryption keys of files in the subtree of path at once.
+// All files are checked before any of them changed, the usage of keys is updated in one pass.
+// It returns the delete operations of old fragments for seas.
+func (root *Root) RotateKeys(p string, rotations []KeyRotation, userOrGroup bool) (map[string][]*sea.Operation, error) {
+	err := validPath(p)
+	if err != nil {
+		return nil, err
+	}
+	if len(rotations) == 0 {
+		return nil, errors.New("rotations shouldn't be nil")
+	}
+	_, err = root.Home.checkPathExists(p)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*File, len(rotations))
+	for i, rotation := range rotations {
+		err = validInfo(rotation.Path, rotation.Info.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(rotation.Path, p) {
+			return nil, errors.New("File isn't in the path: " + rotation.Path + rotation.Info.Name)
+		}
+		err = rotation.Info.Coding.valid(len(rotation.Info.Fragments))
+		if err != nil {
+			return nil, err
+		}
+		err = validFragments(rotation.Info.Fragments)
+		if err != nil {
+			return nil, err
+		}
+		err = validKey(rotation.Info, root.Keys)
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < i; j++ {
+			if rotations[j].Info.KeyIndex == rotation.Info.KeyIndex && rotations[j].Info.Key != rotation.Info.Key {
+				return nil, errors.New("key index is rotated with different keys: " + rotation.Info.KeyIndex)
+			}
+		}
+		files[i], err = root.Home.checkFileExists(rotation.Path, rotation.Info.Name)
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < i; j++ {
+			if files[j] == files[i] {
+				return nil, errors.New("File is rotated repeatedly: " + rotation.Path + rotation.Info.Name)
+			}
+		}
+	}
+	seaOperations := make(map[string][]*sea.Operation)
+	keyUsed := make(map[string]int)
+	for i, rotation := range rotations {
+		info := rotation.Info
+		root.Keys.AddKey(info.KeyIndex, info.Key, false)
+		file := files[i]
+		file.lock()
+		operations := root.Home.updateFileData(file, info.Hash, info.Size, info.Fragments, info.Coding, userOrGroup, false)
+		keyUsed[file.KeyIndex]--
+		file.KeyIndex = info.KeyIndex
+		keyUsed[file.KeyIndex]++
+		file.unlock()
+		for addr, ops := range operations {
+			seaOperations[addr] = append(seaOperations[addr], ops...)
+		}
+		root.Home.updateDirectorySize(rotation.Path)
+	}
+	root.Keys.UpdateKeyUsed(keyUsed)
+	return seaOperations, nil
+}
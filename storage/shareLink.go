@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"time"
+
+	"github.com/mitchellh/copystructure"
+	"github.com/yellowssi/SeaStorage-TP/sea"
+)
+
+// ShareLink is the capability-style share of a file.
+// It is stored at the address derived from the link public key,
+// anyone holding the link private key can decrypt the file key and resolve the file.
+type ShareLink struct {
+	Owner      string
+	PublicKey  string
+	Name       string
+	Size       int64
+	Hash       string
+	Key        string
+	KeyIndex   string
+	Fragments  []*Fragment
+	Coding     Coding
+	Expiration int64
+	Limit      int
+	Downloads  int
+}
+
+// ShareLinkInfo is the information of share link provided by the owner.
+// Key is the file key encrypted by the link public key.
+// Limit is the maximum count of downloads, 0 means unlimited.
+type ShareLinkInfo struct {
+	PublicKey  string
+	Key        string
+	Expiration int64
+	Limit      int
+}
+
+// NewShareLinkInfo is the construct for ShareLinkInfo.
+func NewShareLinkInfo(publicKey, key string, expiration int64, limit int) *ShareLinkInfo {
+	return &ShareLinkInfo{
+		PublicKey:  publicKey,
+		Key:        key,
+		Expiration: expiration,
+		Limit:      limit,
+	}
+}
+
+// Check the share link information whether valid.
+func (info ShareLinkInfo) valid(now time.Time) error {
+	if info.PublicKey == "" {
+		return errors.New("public key of share link shouldn't be nil")
+	}
+	if info.Key == "" {
+		return errors.New("key of share link shouldn't be nil")
+	}
+	if !time.Unix(info.Expiration, 0).After(now) {
+		return errors.New("share link is expired")
+	}
+	if info.Limit < 0 {
+		return errors.New("limit of share link shouldn't be negative")
+	}
+	return nil
+}
+
+// CreateShareLink generate the share link of the file in the path.
+// The fragments of file are copied into the link, so that it keeps resolvable while the file is updated.
+func (root *Root) CreateShareLink(owner, p, name string, info ShareLinkInfo, now time.Time, userOrGroup bool) (*ShareLink, map[string][]*sea.Operation, error) {
+	err := validInfo(p, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = info.valid(now)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := root.Home.checkFileExists(p, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	fragments, err := copystructure.Copy(f.Fragments)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The contracts are kept by the file, the link only needs the seas to download.
+	for _, fragment := range fragments.([]*Fragment) {
+		for _, s := range fragment.Seas {
+			s.Contract = nil
+		}
+	}
+	link := &ShareLink{
+		Owner:      owner,
+		PublicKey:  info.PublicKey,
+		Name:       f.Name,
+		Size:       f.Size,
+		Hash:       f.Hash,
+		Key:        info.Key,
+		KeyIndex:   f.KeyIndex,
+		Fragments:  fragments.([]*Fragment),
+		Coding:     f.Coding,
+		Expiration: info.Expiration,
+		Limit:      info.Limit,
+		Downloads:  0,
+	}
+	if userOrGroup {
+		return link, link.generateSeaOperations(sea.ActionUserShared), nil
+	}
+	return link, link.generateSeaOperations(sea.ActionGroupShared), nil
+}
+
+// Generate the operations of seas storing the fragments of link, referenced by the link public key.
+func (sl *ShareLink) generateSeaOperations(action uint) map[string][]*sea.Operation {
+	seaOperations := make(map[string][]*sea.Operation)
+	for _, fragment := range sl.Fragments {
+		for _, fragmentSea := range fragment.Seas {
+			operation := sea.NewOperation(action, "", fragment.Hash, fragment.Size, true)
+			operation.StoredID = fragmentSea.StoredID
+			operation.Ref = sl.PublicKey
+			seaOperations[fragmentSea.Address] = append(seaOperations[fragmentSea.Address], operation)
+		}
+	}
+	return seaOperations
+}
+
+// UnshareOperations returns the operations for seas to stop sharing the fragments of link,
+// used when the link is revoked or reached the download limit.
+func (sl *ShareLink) UnshareOperations(userOrGroup bool) map[string][]*sea.Operation {
+	if userOrGroup {
+		return sl.generateSeaOperations(sea.ActionUserDelete)
+	}
+	return sl.generateSeaOperations(sea.ActionGroupDelete)
+}
+
+// Expired returns whether the share link is expired at the time.
+func (sl *ShareLink) Expired(now time.Time) bool {
+	return !time.Unix(sl.Expiration, 0).After(now)
+}
+
+// Exhausted returns whether the share link reached the download limit.
+func (sl *ShareLink) Exhausted() bool {
+	return sl.Limit > 0 && sl.Downloads >= sl.Limit
+}
+
+// Resolve check the share link whether available and count the download.
+// It returns whether the link is exhausted by the download, then the seas should stop sharing.
+func (sl *ShareLink) Resolve(now time.Time) (bool, error) {
+	if sl.Expired(now) {
+		return false, errors.New("share link is expired")
+	}
+	if sl.Exhausted() {
+		return false, errors.New("share link reached the download limit")
+	}
+	sl.Downloads++
+	return sl.Exhausted(), nil
+}
+
+// FileInfo returns the information of shared file.
+// The key of file info is encrypted by the link public key.
+func (sl *ShareLink) FileInfo() FileInfo {
+	info := *NewFileInfo(sl.Name, sl.Size, sl.Hash, sl.Key, sl.Fragments)
+	info.KeyIndex = sl.KeyIndex
+	info.Coding = sl.Coding
+	return info
+}
+
+// ToBytes convert share link to byte slice.
+func (sl *ShareLink) ToBytes() []byte {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	_ = enc.Encode(sl)
+	return buf.Bytes()
+}
+
+// ShareLinkFromBytes convert share link from byte slice.
+func ShareLinkFromBytes(data []byte) (*ShareLink, error) {
+	sl := &ShareLink{}
+	buf := bytes.NewBuffer(data)
+	dec := gob.NewDecoder(buf)
+	err := dec.Decode(sl)
+	return sl, err
+}
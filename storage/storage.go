@@ -19,9 +19,9 @@ import (
 	"encoding/gob"
 	"errors"
 	"github.com/mitchellh/copystructure"
-	"github.com/yellowssi/SeaStorage-TP/crypto"
 	"github.com/yellowssi/SeaStorage-TP/sea"
 	"strings"
+	"time"
 )
 
 func init() {
@@ -39,12 +39,16 @@ type Root struct {
 }
 
 // FileInfo is the information of files for usage.
+// Key is wrapped by the owner public key, KeyIndex is the SHA512 of the plaintext key.
 type FileInfo struct {
 	Name      string
 	Size      int64
 	Hash      string
 	Key       string
+	KeyIndex  string
 	Fragments []*Fragment
+	Coding    Coding
+	Retention int64 // seconds, 0 means ContractDuration
 }
 
 // NewRoot is the construct for Root.
@@ -123,11 +127,26 @@ func (root *Root) CreateFile(p string, info FileInfo) error {
 	if err != nil {
 		return err
 	}
-	fileKeyIndex := root.Keys.AddKey(info.Key, true)
-	err = root.Home.CreateFile(p, info.Name, info.Hash, fileKeyIndex, info.Size, info.Fragments)
+	err = info.Coding.valid(len(info.Fragments))
 	if err != nil {
 		return err
 	}
+	err = validFragments(info.Fragments)
+	if err != nil {
+		return err
+	}
+	if info.Retention < 0 {
+		return errors.New("retention of file shouldn't be negative")
+	}
+	err = validKey(info, root.Keys)
+	if err != nil {
+		return err
+	}
+	err = root.Home.CreateFile(p, info.Name, info.Hash, info.KeyIndex, info.Size, info.Fragments, info.Coding, info.Retention)
+	if err != nil {
+		return err
+	}
+	root.Keys.AddKey(info.KeyIndex, info.Key, true)
 	root.Home.updateDirectorySize(p)
 	return nil
 }
@@ -151,7 +170,15 @@ func (root *Root) UpdateFileData(p string, info FileInfo, userOrGroup bool) (map
 	if err != nil {
 		return nil, err
 	}
-	return root.Home.UpdateFileData(p, info.Name, info.Hash, info.Size, info.Fragments, userOrGroup, false)
+	err = info.Coding.valid(len(info.Fragments))
+	if err != nil {
+		return nil, err
+	}
+	err = validFragments(info.Fragments)
+	if err != nil {
+		return nil, err
+	}
+	return root.Home.UpdateFileData(p, info.Name, info.Hash, info.Size, info.Fragments, info.Coding, userOrGroup, false)
 }
 
 // UpdateFileKey change the encryption key of file and its information.
@@ -160,8 +187,20 @@ func (root *Root) UpdateFileKey(p string, info FileInfo, userOrGroup bool) (map[
 	if err != nil {
 		return nil, err
 	}
-	root.Keys.AddKey(info.Key, false)
-	keyUsed, seaOperations, err := root.Home.UpdateFileKey(p, info.Name, crypto.SHA512HexFromHex(info.Key), info.Hash, info.Size, info.Fragments, userOrGroup, false)
+	err = info.Coding.valid(len(info.Fragments))
+	if err != nil {
+		return nil, err
+	}
+	err = validFragments(info.Fragments)
+	if err != nil {
+		return nil, err
+	}
+	err = validKey(info, root.Keys)
+	if err != nil {
+		return nil, err
+	}
+	root.Keys.AddKey(info.KeyIndex, info.Key, false)
+	keyUsed, seaOperations, err := root.Home.UpdateFileKey(p, info.Name, info.KeyIndex, info.Hash, info.Size, info.Fragments, info.Coding, userOrGroup, false)
 	if err != nil {
 		return nil, err
 	}
@@ -169,9 +208,14 @@ func (root *Root) UpdateFileKey(p string, info FileInfo, userOrGroup bool) (map[
 	return seaOperations, nil
 }
 
-// PublishKey publish the key encrypted by public key.
-func (root *Root) PublishKey(publicKey, keyIndex, key string) error {
-	return root.Keys.PublishKey(publicKey, keyIndex, key)
+// PublishKey publish the plaintext key matching the index.
+func (root *Root) PublishKey(publicKey, keyIndex, key string, now time.Time) error {
+	return root.Keys.PublishKey(publicKey, keyIndex, key, now)
+}
+
+// PublishKeyTo publish the key encrypted by the public key of recipient.
+func (root *Root) PublishKeyTo(publicKey, keyIndex, recipient, key string, now time.Time) error {
+	return root.Keys.PublishKeyTo(publicKey, keyIndex, recipient, key, now)
 }
 
 // DeleteFile delete file in the path.
@@ -238,7 +282,11 @@ func (root *Root) GetFile(p, name string) (file FileInfo, err error) {
 		return
 	}
 	key := root.Keys.GetKey(f.KeyIndex)
-	return *NewFileInfo(f.Name, f.Size, f.Hash, key.Key, f.Fragments), nil
+	file = *NewFileInfo(f.Name, f.Size, f.Hash, key.Key, f.Fragments)
+	file.KeyIndex = f.KeyIndex
+	file.Coding = f.Coding
+	file.Retention = f.Retention
+	return file, nil
 }
 
 // GetDirectory returns the information of directory.
@@ -275,7 +323,11 @@ func (root *Root) GetSharedFile(p, name string) (file FileInfo, err error) {
 		return
 	}
 	key := root.Keys.GetKey(f.KeyIndex)
-	return *NewFileInfo(f.Name, f.Size, f.Hash, key.Key, f.Fragments), nil
+	file = *NewFileInfo(f.Name, f.Size, f.Hash, key.Key, f.Fragments)
+	file.KeyIndex = f.KeyIndex
+	file.Coding = f.Coding
+	file.Retention = f.Retention
+	return file, nil
 }
 
 // GetSharedDirectory returns the information of directory in the 'shared' directory.
@@ -306,6 +358,67 @@ func (root *Root) AddSea(p, name, hash string, sea *FragmentSea) error {
 	return root.Home.AddSea(p, name, hash, sea)
 }
 
+// GetFragment returns the fragment of file in the path by its hash.
+func (root *Root) GetFragment(p, name, hash string) (*Fragment, error) {
+	err := validInfo(p, name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := root.Home.checkFileExists(p, name)
+	if err != nil {
+		return nil, err
+	}
+	return f.GetFragment(hash)
+}
+
+// UpdateSeaWeight update the weight of sea storing the fragment with the hash.
+// It returns the count of fragments updated.
+func (root *Root) UpdateSeaWeight(address, hash string, weight int8) int {
+	return root.Home.updateSeaWeight(address, hash, weight) + root.Shared.updateSeaWeight(address, hash, weight)
+}
+
+// CheckSeaAvailable check the sea with the public key whether can store the fragment with the hash.
+// The sea can't store the same fragment twice or another shard of the erasure coded file.
+func (root *Root) CheckSeaAvailable(publicKey, hash string) error {
+	for _, dir := range []*Directory{root.Home, root.Shared} {
+		err := dir.checkSeaAvailable(publicKey, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Settle the contracts of the sea storing the fragments of files in 'home' directory at the time.
+// It returns the amount due to the sea.
+func (root *Root) Settle(address string, now time.Time) int64 {
+	return root.Home.settle(address, now)
+}
+
+// ReplaceSea replace the sea storing the fragment by the record with the id with the new sea at the time, used to repair the fragment.
+// The new sea should confirm the merkle root of fragment as storing it.
+// It returns the error if the new sea can't store the fragment or the fragment isn't stored in the sea.
+func (root *Root) ReplaceSea(address string, storedID uint64, hash, merkleRoot string, sea *FragmentSea, now time.Time) error {
+	err := root.CheckSeaAvailable(sea.PublicKey, hash)
+	if err != nil {
+		return err
+	}
+	fragment := root.Home.findStored(address, storedID, hash)
+	if fragment == nil {
+		fragment = root.Shared.findStored(address, storedID, hash)
+	}
+	if fragment == nil {
+		return errors.New("fragment isn't stored in sea: " + address)
+	}
+	if fragment.MerkleRoot != merkleRoot {
+		return errors.New("merkle root of fragment mismatch")
+	}
+	if root.Home.replaceSea(address, storedID, hash, sea, now)+root.Shared.replaceSea(address, storedID, hash, sea, now) == 0 {
+		return errors.New("fragment isn't stored in sea: " + address)
+	}
+	return nil
+}
+
 // ShareFiles copy the information of file to 'shared' directory.
 func (root *Root) ShareFiles(p, name, dst string, userOrGroup bool) (map[string][]*sea.Operation, []string, error) {
 	iNode, err := root.GetINode(p, name)
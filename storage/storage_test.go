@@ -1,13 +1,23 @@
 package storage
 
 import (
+	"fmt"
+	"github.com/hyperledger/sawtooth-sdk-go/signing"
+	"github.com/yellowssi/SeaStorage-TP/crypto"
 	"github.com/yellowssi/SeaStorage-TP/sea"
+	"math"
 	"testing"
 	"time"
 )
 
 var root = GenerateRoot()
 
+// The key of file info isn't wrapped in tests, only the index is derived.
+func indexed(info *FileInfo) FileInfo {
+	info.KeyIndex = crypto.SHA512HexFromHex(info.Key)
+	return *info
+}
+
 func TestValidName(t *testing.T) {
 	var err error
 	err = validName("abcdefghijklmnopqrstuvwxyz0123456789`~!@#$%^&*()-_=+[]{}|;:'\",.<>?")
@@ -65,7 +75,13 @@ func TestRoot_GetDirectory(t *testing.T) {
 }
 
 func TestRoot_CreateFile(t *testing.T) {
-	err := root.CreateFile("/home/SeaStorage/", *NewFileInfo("test", 256, "hash", "key", []*Fragment{{Hash: "test", Size: 1}}))
+	forged := NewFragmentSea("address", "publicKey", time.Now())
+	forged.Contract = &Contract{Escrow: 100}
+	err := root.CreateFile("/home/SeaStorage/", indexed(NewFileInfo("forged", 256, "hash", "key", []*Fragment{{Hash: "test", Size: 1, Seas: []*FragmentSea{forged}}})))
+	if err == nil {
+		t.Error("seas of fragment shouldn't be submitted by user")
+	}
+	err = root.CreateFile("/home/SeaStorage/", indexed(NewFileInfo("test", 256, "hash", "key", []*Fragment{{Hash: "test", Size: 1}})))
 	if err != nil {
 		t.Error(err)
 	}
@@ -80,6 +96,81 @@ func TestRoot_AddSea(t *testing.T) {
 	t.Log(root.Home.ToJson())
 }
 
+func TestRoot_UpdateSeaWeight(t *testing.T) {
+	err := root.AddSea("/home/SeaStorage/", "test", "test", NewFragmentSea("address2", "publicKey2", time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.UpdateSeaWeight("address2", "test", 80) != 1 {
+		t.Error("weight of sea should be updated")
+	}
+	fragment, err := root.GetFragment("/home/SeaStorage/", "test", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fragment.PreferredSeas()[0].Address != "address2" {
+		t.Error("sea with higher weight should be preferred")
+	}
+}
+
+func TestRoot_ReplaceSea(t *testing.T) {
+	err := root.ReplaceSea("address2", 0, "test", "", NewFragmentSea("address", "publicKey", time.Now()), time.Now())
+	if err == nil {
+		t.Error("sea storing the fragment shouldn't replace another sea")
+	}
+	if root.ReplaceSea("address2", 0, "test", "root", NewFragmentSea("address3", "publicKey3", time.Now()), time.Now()) == nil {
+		t.Error("merkle root of fragment should be confirmed")
+	}
+	if root.ReplaceSea("address2", 1, "test", "", NewFragmentSea("address3", "publicKey3", time.Now()), time.Now()) == nil {
+		t.Error("sea storing another record shouldn't be replaced")
+	}
+	err = root.ReplaceSea("address2", 0, "test", "", NewFragmentSea("address3", "publicKey3", time.Now()), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fragment, err := root.GetFragment("/home/SeaStorage/", "test", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fragment.GetSea("address2")
+	if err == nil {
+		t.Error("sea should be replaced")
+	}
+	_, err = fragment.GetSea("address3")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRoot_AddSeaErasure(t *testing.T) {
+	info := NewFileInfo("erasure", 256, "hash", "key", []*Fragment{{Hash: "shard0", Size: 1}, {Hash: "shard1", Size: 1}, {Hash: "parity", Size: 1}})
+	info.Coding = Coding{DataShards: 2, ParityShards: 2}
+	err := root.CreateFile("/home/SeaStorage/", indexed(info))
+	if err == nil {
+		t.Error("coding should match the count of fragments")
+	}
+	if (Coding{DataShards: 200, ParityShards: 100}).valid(300) == nil {
+		t.Error("coding should not exceed the maximum count of shards")
+	}
+	info.Coding = Coding{DataShards: 2, ParityShards: 1}
+	err = root.CreateFile("/home/SeaStorage/", indexed(info))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = root.AddSea("/home/SeaStorage/", "erasure", "shard0", NewFragmentSea("address", "publicKey", time.Now()))
+	if err != nil {
+		t.Error(err)
+	}
+	err = root.AddSea("/home/SeaStorage/", "erasure", "shard1", NewFragmentSea("address", "publicKey", time.Now()))
+	if err == nil {
+		t.Error("shards of file should be stored in distinct seas")
+	}
+	_, err = root.DeleteFile("/home/SeaStorage/", "erasure", true)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
 func TestRoot_GenerateSeaOperations(t *testing.T) {
 	t.Log(root.Home.GenerateSeaOperations(sea.ActionUserDelete, false))
 }
@@ -94,6 +185,48 @@ func TestRoot_ShareFiles(t *testing.T) {
 	t.Log(root.Shared.ToJson())
 }
 
+func TestRoot_CreateShareLink(t *testing.T) {
+	info := NewShareLinkInfo("linkPublicKey", "encryptedKey", time.Now().Add(time.Hour).Unix(), 1)
+	link, operations, err := root.CreateShareLink("owner", "/home/SeaStorage/", "test", *info, time.Now(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ops := range operations {
+		for _, op := range ops {
+			if op.Ref != "linkPublicKey" {
+				t.Error("operations should reference the share link")
+			}
+		}
+	}
+	for _, fragment := range link.Fragments {
+		for _, s := range fragment.Seas {
+			if s.Contract != nil {
+				t.Error("contracts shouldn't be copied into share link")
+			}
+		}
+	}
+	exhausted, err := link.Resolve(time.Now())
+	if err != nil {
+		t.Error(err)
+	}
+	if !exhausted {
+		t.Error("share link should be exhausted by the download")
+	}
+	if _, err = link.Resolve(time.Now()); err == nil {
+		t.Error("share link should reach the download limit")
+	}
+	if len(link.UnshareOperations(true)) != len(operations) {
+		t.Error("seas sharing the link should stop sharing")
+	}
+	test, err := ShareLinkFromBytes(link.ToBytes())
+	if err != nil {
+		t.Error(err)
+	}
+	if test.Expired(time.Now()) || !test.Expired(time.Now().Add(2*time.Hour)) {
+		t.Error("invalid expiration of share link")
+	}
+}
+
 func TestRoot_DeleteFile(t *testing.T) {
 	seaOperations, err := root.DeleteFile("/home/SeaStorage/", "test", true)
 	if err != nil {
@@ -136,3 +269,287 @@ func TestRootFromBytes(t *testing.T) {
 		t.Log(test)
 	}
 }
+
+func TestContract_Settle(t *testing.T) {
+	now := time.Now()
+	contract, err := NewContract(contractGigabyte, 30, now, 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contract.Escrow != 30 {
+		t.Errorf("escrow should be the cost of whole duration: %d", contract.Escrow)
+	}
+	due := contract.Settle(now.Add(24 * time.Hour))
+	if due != 1 {
+		t.Errorf("due of one day should be settled: %d", due)
+	}
+	if contract.Settle(now.Add(24*time.Hour)) != 0 {
+		t.Error("settled time shouldn't be settled twice")
+	}
+	due += contract.Settle(now.Add(60 * 24 * time.Hour))
+	if due != 30 || contract.Escrow != 0 {
+		t.Error("escrow should be settled when contract is ended")
+	}
+	_, err = NewContract(math.MaxInt64, math.MaxInt64, now, time.Hour)
+	if err == nil {
+		t.Error("contract with cost overflowed shouldn't be created")
+	}
+}
+
+func TestContract_Transfer(t *testing.T) {
+	now := time.Now()
+	contract, err := NewContract(contractGigabyte, 30, now, 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract.Settle(now.Add(24 * time.Hour))
+	transferred := contract.Transfer(now.Add(10 * 24 * time.Hour))
+	if transferred.Escrow != 29 || transferred.End != contract.End {
+		t.Error("escrow not settled should be transferred until the end of contract")
+	}
+	if transferred.Settle(now.Add(10*24*time.Hour)) != 0 {
+		t.Error("time before transfer shouldn't be settled to the new sea")
+	}
+	if transferred.Settle(now.Add(30*24*time.Hour)) != 29 {
+		t.Error("escrow should be settled when contract is ended")
+	}
+	ended := contract.Transfer(now.Add(60 * 24 * time.Hour))
+	if ended.Settle(now.Add(60*24*time.Hour)) != 29 {
+		t.Error("escrow of contract ended should be settled")
+	}
+}
+
+func TestRoot_SweepExpired(t *testing.T) {
+	r := GenerateRoot()
+	err := r.CreateFile("/", indexed(NewFileInfo("test", 256, "hash", "key", []*Fragment{{Hash: "test", Size: 256}})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	fragmentSea := NewFragmentSea("address", "publicKey", now)
+	fragmentSea.Contract, err = NewContract(256, 10, now, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fragmentSea.Expiry = fragmentSea.Contract.End
+	err = r.AddSea("/", "test", "test", fragmentSea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, count := r.SweepExpired(now, true)
+	if count != 0 {
+		t.Error("file shouldn't be expired")
+	}
+	_, err = r.RenewFile("/", "test", time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, count = r.SweepExpired(now.Add(time.Hour), true)
+	if count != 0 {
+		t.Error("renewed file shouldn't be expired")
+	}
+	_, count = r.SweepExpired(now.Add(2*time.Hour), true)
+	if count != 0 {
+		t.Error("file in the grace shouldn't be swept")
+	}
+	seaOperations, count := r.SweepExpired(now.Add(2*time.Hour+SweepGrace), true)
+	if count != 1 || len(seaOperations["address"]) != 1 {
+		t.Error("expired file should be deleted")
+	}
+	if r.Home.Size != 0 {
+		t.Error("size of directory should be updated")
+	}
+}
+
+func TestFragmentSea_Challenge(t *testing.T) {
+	now := time.Now()
+	fragmentSea := NewFragmentSea("address", "publicKey", now)
+	if err := fragmentSea.Challenge(now); err != nil {
+		t.Fatal(err)
+	}
+	if fragmentSea.Challenge(now.Add(time.Hour)) == nil {
+		t.Error("fragment shouldn't be challenged in the cooldown")
+	}
+	if err := fragmentSea.Challenge(now.Add(sea.ChallengeCooldown)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRoot_CloseContracts(t *testing.T) {
+	r := GenerateRoot()
+	err := r.CreateFile("/", indexed(NewFileInfo("test", 1<<30, "hash", "key", []*Fragment{{Hash: "test", Size: 1 << 30}})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	fragmentSea := NewFragmentSea("address", "publicKey", now)
+	fragmentSea.Contract, err = NewContract(1<<30, 30*24, now, 10*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.AddSea("/", "test", "test", fragmentSea)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contracts := r.Contracts()
+	due, refund := r.CloseContracts(contracts, now)
+	if len(due) != 0 || refund != 0 {
+		t.Error("contracts remained shouldn't be closed")
+	}
+	_, err = r.DeleteFile("/", "test", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, refund = r.CloseContracts(contracts, now.Add(3*time.Hour))
+	if due["address"] != 3 || refund != 7 {
+		t.Errorf("earned cost should be settled and the remaining escrow refunded: %d %d", due["address"], refund)
+	}
+}
+
+func TestRoot_AddSeaMaxReplicas(t *testing.T) {
+	r := GenerateRoot()
+	err := r.CreateFile("/", indexed(NewFileInfo("test", 1, "hash", "key", []*Fragment{{Hash: "test", Size: 1}})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < MaxReplicas; i++ {
+		err = r.AddSea("/", "test", "test", NewFragmentSea(fmt.Sprint("address", i), fmt.Sprint("publicKey", i), time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = r.AddSea("/", "test", "test", NewFragmentSea("address", "publicKey", time.Now()))
+	if err == nil {
+		t.Error("fragment shouldn't exceed the maximum replicas")
+	}
+}
+
+func TestRoot_RotateKeys(t *testing.T) {
+	r := GenerateRoot()
+	err := r.CreateDirectory("/team/docs/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/team/", "/team/docs/"} {
+		err = r.CreateFile(p, indexed(NewFileInfo("test", 1, "hash", "01", []*Fragment{{Hash: "test", Size: 1}})))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.AddSea(p, "test", "test", NewFragmentSea("address", "publicKey", time.Now()))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldIndex := crypto.SHA512HexFromHex("01")
+	rotations := []KeyRotation{
+		{Path: "/team/", Info: indexed(NewFileInfo("test", 2, "hash2", "02", []*Fragment{{Hash: "test2", Size: 2}}))},
+		{Path: "/", Info: indexed(NewFileInfo("test", 2, "hash2", "02", []*Fragment{{Hash: "test2", Size: 2}}))},
+	}
+	_, err = r.RotateKeys("/team/", rotations, true)
+	if err == nil {
+		t.Error("file outside the path shouldn't be rotated")
+	}
+	if r.Keys.GetKey(oldIndex).Used != 2 {
+		t.Error("keys shouldn't be changed when rotation failed")
+	}
+	rotations[1].Path = "/team/docs/"
+	seaOperations, err := r.RotateKeys("/team/", rotations, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seaOperations["address"]) != 2 {
+		t.Error("old fragments should be deleted from seas")
+	}
+	if r.Keys.GetKey(oldIndex) != nil {
+		t.Error("unused key should be removed")
+	}
+	if r.Keys.GetKey(crypto.SHA512HexFromHex("02")).Used != 2 {
+		t.Error("new key should be used by rotated files")
+	}
+	if r.Home.Size != 4 {
+		t.Errorf("size of directory should be updated: %d", r.Home.Size)
+	}
+}
+
+func TestFileKeyMap_PublishKey(t *testing.T) {
+	fkm := NewFileKeyMap()
+	index := crypto.SHA512HexFromHex("01")
+	fkm.AddKey(index, "01", true)
+	now := time.Now()
+	if fkm.PublishKey("publisher", index, "02", now) == nil {
+		t.Error("key not matching the index shouldn't be published")
+	}
+	for _, recipient := range []string{"recipient", "a", "z", "recipient"} {
+		err := fkm.PublishKeyTo("publisher", index, recipient, "encrypted "+recipient, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	fileKey := fkm.GetKey(index)
+	if len(fileKey.Recipients) != 3 || fileKey.Recipients[0].Recipient != "a" || fileKey.Recipients[2].Recipient != "z" {
+		t.Error("recipients should be sorted without duplication")
+	}
+	publication, err := fileKey.PublishedKey("recipient")
+	if err != nil || publication.Key != "encrypted recipient" {
+		t.Error("key should be published to the recipient")
+	}
+	if _, err = fileKey.PublishedKey("other"); err == nil {
+		t.Error("key shouldn't be published to other recipient")
+	}
+	err = fkm.PublishKey("publisher", index, "01", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publication, err = fileKey.PublishedKey("other")
+	if err != nil || publication.Key != "01" || publication.Publisher != "publisher" {
+		t.Error("plaintext key should be published to everyone")
+	}
+	if fileKey.Key != "01" || !fileKey.Published {
+		t.Error("private form of key should be kept")
+	}
+}
+
+func TestFileInfo_WrapKey(t *testing.T) {
+	cont := signing.NewSecp256k1Context()
+	priv := cont.NewRandomPrivateKey()
+	key := crypto.NewAESKey(256)
+	info := NewFileInfo("test", 1, "hash", key, []*Fragment{{Hash: "test", Size: 1}})
+	err := info.WrapKey(cont.GetPublicKey(priv).AsHex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Key == key || info.KeyIndex != crypto.SHA512HexFromHex(key) {
+		t.Error("key should be wrapped and indexed by the plaintext key")
+	}
+	r := GenerateRoot()
+	err = r.CreateFile("/", *info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := NewFileInfo("other", 1, "hash", key, []*Fragment{{Hash: "other", Size: 1}})
+	err = other.WrapKey(cont.GetPublicKey(priv).AsHex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.CreateFile("/", *other) == nil {
+		t.Error("key index shouldn't be reused with different wrapped key")
+	}
+	other.Key = info.Key
+	err = r.CreateFile("/", *other)
+	if err != nil {
+		t.Error("key index should be reused with the same wrapped key", err)
+	}
+	file, err := r.GetFile("/", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = file.UnwrapKey(priv.AsHex())
+	if err != nil || file.Key != key {
+		t.Error("key should be unwrapped by the owner private key", err)
+	}
+	file.Key = info.Key
+	file.KeyIndex = crypto.SHA512HexFromHex("01")
+	if file.UnwrapKey(priv.AsHex()) == nil {
+		t.Error("key not matching the index should be rejected")
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/yellowssi/SeaStorage-TP/user"
+)
+
+// Client uploads and downloads the fragments from the endpoints of seas.
+type Client struct {
+	HTTPClient *http.Client
+	// ChunkSize is the maximum size of data sent in each upload request.
+	ChunkSize int64
+}
+
+// NewClient is the construct for Client.
+func NewClient() *Client {
+	return &Client{
+		HTTPClient: &http.Client{Timeout: 10 * time.Minute},
+		ChunkSize:  4 * 1024 * 1024,
+	}
+}
+
+func fragmentURL(endpoint string, operation *user.Operation) string {
+	return endpoint + FragmentPath + url.PathEscape(operation.Hash)
+}
+
+func (c *Client) do(method, u string, operation *user.Operation, body io.Reader, header map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(OperationHeader, EncodeOperation(operation))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	return c.HTTPClient.Do(req)
+}
+
+func responseError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+	return fmt.Errorf("transfer failed: %s: %s", resp.Status, body)
+}
+
+// Offset returns the size of fragment received by the sea.
+func (c *Client) Offset(endpoint string, operation *user.Operation) (int64, error) {
+	resp, err := c.do(http.MethodHead, fragmentURL(endpoint, operation), operation, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, responseError(resp)
+	}
+	return strconv.ParseInt(resp.Header.Get(OffsetHeader), 10, 64)
+}
+
+// Upload send the fragment to the sea by the operation signed by the user.
+// The upload resumes from the offset received by the sea, so it can be called again after failure.
+func (c *Client) Upload(endpoint string, operation *user.Operation, r io.ReadSeeker) error {
+	offset, err := c.Offset(endpoint, operation)
+	if err != nil {
+		return err
+	}
+	for offset < operation.Size {
+		_, err = r.Seek(offset, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		end := offset + c.ChunkSize - 1
+		if end >= operation.Size {
+			end = operation.Size - 1
+		}
+		header := map[string]string{
+			"Content-Range": fmt.Sprintf("bytes %d-%d/%d", offset, end, operation.Size),
+		}
+		resp, err := c.do(http.MethodPut, fragmentURL(endpoint, operation), operation, io.LimitReader(r, end-offset+1), header)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusCreated {
+			err = responseError(resp)
+			resp.Body.Close()
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusCreated {
+			return nil
+		}
+		offset, err = strconv.ParseInt(resp.Header.Get(OffsetHeader), 10, 64)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Download write the fragment from the offset into w by the operation signed by the user.
+// If the owner isn't empty, the fragment shared by the owner is downloaded.
+// It returns the size written, so the download can be resumed from the offset plus the size.
+// The fragment downloaded from the beginning is verified by the hash.
+func (c *Client) Download(endpoint string, operation *user.Operation, owner string, offset int64, w io.Writer) (int64, error) {
+	u := fragmentURL(endpoint, operation)
+	if owner != "" {
+		u += "?" + OwnerQuery + "=" + url.QueryEscape(owner)
+	}
+	var header map[string]string
+	if offset > 0 {
+		header = map[string]string{"Range": fmt.Sprintf("bytes=%d-", offset)}
+	}
+	resp, err := c.do(http.MethodGet, u, operation, nil, header)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return 0, responseError(resp)
+	}
+	if offset > 0 && resp.StatusCode != http.StatusPartialContent {
+		return 0, errors.New("range isn't supported by sea")
+	}
+	if offset > 0 {
+		start, _, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return 0, err
+		}
+		if start != offset || total != operation.Size {
+			return 0, errors.New("range of response mismatch")
+		}
+		return io.Copy(w, resp.Body)
+	}
+	sum := sha512.New()
+	n, err := io.Copy(io.MultiWriter(w, sum), resp.Body)
+	if err != nil {
+		return n, err
+	}
+	if hex.EncodeToString(sum.Sum(nil)) != operation.Hash {
+		return n, ErrHashMismatch
+	}
+	return n, nil
+}
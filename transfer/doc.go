@@ -0,0 +1,2 @@
+// Package transfer provides uploading and downloading fragments between clients and seas over HTTP.
+package transfer
@@ -0,0 +1,115 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yellowssi/SeaStorage-TP/user"
+)
+
+// The protocol of transfer.
+// The fragment is uploaded by PUT and downloaded by GET at FragmentPath followed by the hash.
+// The request is authenticated by the operation signed by the device of user in OperationHeader.
+// The upload is resumable by querying OffsetHeader with HEAD and sending the remaining data with Content-Range,
+// the download is resumable by Range.
+const (
+	FragmentPath    = "/fragments/"
+	OperationHeader = "X-SeaStorage-Operation"
+	OffsetHeader    = "X-SeaStorage-Offset"
+	OwnerQuery      = "owner"
+)
+
+var (
+	// ErrUnauthorized is returned when the operation is invalid.
+	ErrUnauthorized = errors.New("invalid operation")
+	// ErrHashMismatch is returned when the data downloaded doesn't match the hash.
+	ErrHashMismatch = errors.New("hash of fragment mismatch")
+)
+
+// EncodeOperation encode the operation into the header value.
+func EncodeOperation(operation *user.Operation) string {
+	return base64.StdEncoding.EncodeToString(operation.ToBytes())
+}
+
+// DecodeOperation decode the operation from the header value.
+func DecodeOperation(value string) (*user.Operation, error) {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return user.OperationFromBytes(data)
+}
+
+// Verify the operation for the sea and the fragment with the hash at the time.
+// The timestamp of operation is the deadline, as it is checked by SeaStoreFile.
+// The operations signed in the legacy version aren't accepted for transfer.
+func verifyOperation(operation *user.Operation, sea, hash string, now time.Time) error {
+	if operation.Sea != sea || operation.Hash != hash || time.Unix(operation.Timestamp, 0).Before(now) {
+		return ErrUnauthorized
+	}
+	if !operation.Verify(false) {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// Parse the header of Content-Range in the form of 'bytes start-end/total'.
+func parseContentRange(value string) (start, end, total int64, err error) {
+	err = fmt.Errorf("invalid content range: %s", value)
+	if !strings.HasPrefix(value, "bytes ") {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(value, "bytes "), "/")
+	if len(parts) != 2 {
+		return
+	}
+	bounds := strings.Split(parts[0], "-")
+	if len(bounds) != 2 {
+		return
+	}
+	start, e1 := strconv.ParseInt(bounds[0], 10, 64)
+	end, e2 := strconv.ParseInt(bounds[1], 10, 64)
+	total, e3 := strconv.ParseInt(parts[1], 10, 64)
+	if e1 != nil || e2 != nil || e3 != nil || start < 0 || end < start || total <= end {
+		return
+	}
+	return start, end, total, nil
+}
+
+// Parse the header of Range in the form of 'bytes=start-', only the open range is supported.
+func parseRange(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if !strings.HasPrefix(value, "bytes=") || !strings.HasSuffix(value, "-") {
+		return 0, fmt.Errorf("invalid range: %s", value)
+	}
+	start, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(value, "bytes="), "-"), 10, 64)
+	if err != nil || start < 0 {
+		return 0, fmt.Errorf("invalid range: %s", value)
+	}
+	return start, nil
+}
+
+func httpError(w http.ResponseWriter, code int, err error) {
+	http.Error(w, err.Error(), code)
+}
@@ -0,0 +1,267 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yellowssi/SeaStorage-TP/blob"
+	"github.com/yellowssi/SeaStorage-TP/crypto"
+	"github.com/yellowssi/SeaStorage-TP/user"
+)
+
+// Accounts resolves the devices of accounts from the state.
+type Accounts interface {
+	// VerifyPublicKey returns whether the public key is an authorized device of the user in the address.
+	VerifyPublicKey(address, publicKey string) (bool, error)
+}
+
+// Server serves the fragments stored in the sea.
+// The partial uploads are staged in StagingDir until all data is received.
+type Server struct {
+	PublicKey  string // the public key of sea
+	StagingDir string
+	store      blob.Store
+	accounts   Accounts
+	mutex      sync.Mutex
+	uploading  map[string]bool
+}
+
+// NewServer is the construct for Server, the staging directory is created if it doesn't exist.
+// The signers of operations are verified as the devices of owners by accounts.
+func NewServer(publicKey, stagingDir string, store blob.Store, accounts Accounts) (*Server, error) {
+	err := os.MkdirAll(stagingDir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		PublicKey:  publicKey,
+		StagingDir: stagingDir,
+		store:      store,
+		accounts:   accounts,
+		uploading:  make(map[string]bool),
+	}, nil
+}
+
+// ServeHTTP dispatch the requests of fragments.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, FragmentPath) {
+		http.NotFound(w, r)
+		return
+	}
+	hash := strings.TrimPrefix(r.URL.Path, FragmentPath)
+	operation, err := DecodeOperation(r.Header.Get(OperationHeader))
+	if err != nil {
+		httpError(w, http.StatusUnauthorized, ErrUnauthorized)
+		return
+	}
+	err = verifyOperation(operation, s.PublicKey, hash, time.Now())
+	if err != nil {
+		httpError(w, http.StatusUnauthorized, err)
+		return
+	}
+	ok, err := s.accounts.VerifyPublicKey(operation.Address, operation.PublicKey)
+	if err != nil {
+		httpError(w, http.StatusBadGateway, err)
+		return
+	} else if !ok {
+		httpError(w, http.StatusUnauthorized, ErrUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodHead:
+		s.offset(w, operation)
+	case http.MethodPut:
+		s.upload(w, r, operation)
+	case http.MethodGet:
+		s.download(w, r, operation)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// The staging file of the upload of owner.
+func (s *Server) stagingPath(operation *user.Operation) string {
+	return filepath.Join(s.StagingDir, crypto.SHA256HexFromBytes([]byte(operation.Address+operation.Hash)))
+}
+
+// Lock the upload of owner, it returns false if the upload is in progress.
+func (s *Server) lock(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.uploading[key] {
+		return false
+	}
+	s.uploading[key] = true
+	return true
+}
+
+func (s *Server) unlock(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.uploading, key)
+}
+
+// Returns the offset of upload, if the fragment is stored, the offset is the size of fragment.
+func (s *Server) offset(w http.ResponseWriter, operation *user.Operation) {
+	offset, err := s.store.Size(operation.Address, operation.Hash)
+	if err != nil {
+		offset = 0
+		info, err := os.Stat(s.stagingPath(operation))
+		if err == nil {
+			offset = info.Size()
+		}
+	}
+	w.Header().Set(OffsetHeader, strconv.FormatInt(offset, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+// Append the data to the staging file, the fragment is stored when all data is received.
+func (s *Server) upload(w http.ResponseWriter, r *http.Request, operation *user.Operation) {
+	start, end, total := int64(0), operation.Size-1, operation.Size
+	if value := r.Header.Get("Content-Range"); value != "" {
+		var err error
+		start, end, total, err = parseContentRange(value)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if total != operation.Size {
+		httpError(w, http.StatusBadRequest, errors.New("size of fragment mismatch"))
+		return
+	}
+	p := s.stagingPath(operation)
+	if !s.lock(p) {
+		httpError(w, http.StatusConflict, errors.New("fragment is uploading"))
+		return
+	}
+	defer s.unlock(p)
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if info.Size() != start {
+		f.Close()
+		w.Header().Set(OffsetHeader, strconv.FormatInt(info.Size(), 10))
+		httpError(w, http.StatusRequestedRangeNotSatisfiable, errors.New("offset of upload mismatch"))
+		return
+	}
+	_, err = f.Seek(start, io.SeekStart)
+	if err == nil {
+		_, err = io.CopyN(f, r.Body, end-start+1)
+	}
+	offset, _ := f.Seek(0, io.SeekCurrent)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	w.Header().Set(OffsetHeader, strconv.FormatInt(offset, 10))
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	if offset < total {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	f, err = os.Open(p)
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	_, err = s.store.Put(operation.Address, operation.Hash, f)
+	f.Close()
+	os.Remove(p)
+	if err == blob.ErrHashMismatch {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Serve the fragment from the offset of range.
+// The fragment of other owner can be downloaded if it is shared.
+func (s *Server) download(w http.ResponseWriter, r *http.Request, operation *user.Operation) {
+	owner := r.URL.Query().Get(OwnerQuery)
+	if owner == "" {
+		owner = operation.Address
+	} else if owner != operation.Address {
+		shared, err := s.store.IsShared(owner, operation.Hash)
+		if err != nil || !shared {
+			httpError(w, http.StatusNotFound, blob.ErrNotFound)
+			return
+		}
+	}
+	// The range is checked with the size stored, as the size of operation is claimed by the user.
+	size, err := s.store.Size(owner, operation.Hash)
+	if err == blob.ErrNotFound {
+		httpError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	start, err := parseRange(r.Header.Get("Range"))
+	if err == nil && start > 0 && start >= size {
+		err = errors.New("range out of fragment")
+	}
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		httpError(w, http.StatusRequestedRangeNotSatisfiable, err)
+		return
+	}
+	reader, err := s.store.Open(owner, operation.Hash)
+	if err == blob.ErrNotFound {
+		httpError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer reader.Close()
+	// The skipped data is read, so that the fragment is verified by the hash at the end.
+	skipped, err := io.CopyN(ioutil.Discard, reader, start)
+	if err != nil && skipped < start {
+		httpError(w, http.StatusRequestedRangeNotSatisfiable, errors.New("range out of fragment"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Accept-Ranges", "bytes")
+	if start > 0 {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, size-1, size))
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	_, _ = io.Copy(w, reader)
+}
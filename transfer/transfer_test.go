@@ -0,0 +1,156 @@
+package transfer
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/sawtooth-sdk-go/signing"
+	"github.com/yellowssi/SeaStorage-TP/blob"
+	"github.com/yellowssi/SeaStorage-TP/crypto"
+	"github.com/yellowssi/SeaStorage-TP/user"
+)
+
+// The accounts of test with the device of each address.
+type testAccounts map[string]string
+
+func (a testAccounts) VerifyPublicKey(address, publicKey string) (bool, error) {
+	return a[address] == publicKey, nil
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, blob.Store, testAccounts, func()) {
+	dir, err := ioutil.TempDir("", "transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := blob.NewFileStore(dir + "/blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := make(testAccounts)
+	server, err := NewServer("sea", dir+"/staging", store, accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server)
+	return ts, store, accounts, func() {
+		ts.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func newTestOperation(data []byte, size int64) *user.Operation {
+	cont := signing.NewSecp256k1Context()
+	signer := signing.NewCryptoFactory(cont).NewSigner(cont.NewRandomPrivateKey())
+	return user.NewOperation("address", signer.GetPublicKey().AsHex(), "sea", "/", "name", crypto.SHA512HexFromBytes(data), size, time.Now().Add(time.Hour).Unix(), 0, *signer)
+}
+
+func TestClient_Upload(t *testing.T) {
+	ts, store, accounts, clean := newTestServer(t)
+	defer clean()
+	data := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(data)
+	operation := newTestOperation(data, int64(len(data)))
+	accounts[operation.Address] = operation.PublicKey
+	client := NewClient()
+	client.ChunkSize = 4096
+
+	// The interrupted upload.
+	req, _ := http.NewRequest(http.MethodPut, ts.URL+FragmentPath+operation.Hash, bytes.NewReader(data[:4096]))
+	req.Header.Set(OperationHeader, EncodeOperation(operation))
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes 0-4095/%d", len(data)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	offset, err := client.Offset(ts.URL, operation)
+	if err != nil || offset != 4096 {
+		t.Fatalf("offset should be resumed: %d %v", offset, err)
+	}
+	err = client.Upload(ts.URL, operation, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.Open(operation.Address, operation.Hash)
+	if err != nil {
+		t.Error("fragment should be stored")
+	}
+
+	var buf bytes.Buffer
+	n, err := client.Download(ts.URL, operation, "", 0, &buf)
+	if err != nil || n != int64(len(data)) || !bytes.Equal(buf.Bytes(), data) {
+		t.Error("fragment should be downloaded")
+	}
+	buf.Reset()
+	_, err = client.Download(ts.URL, operation, "", 5000, &buf)
+	if err != nil || !bytes.Equal(buf.Bytes(), data[5000:]) {
+		t.Error("download should be resumed from offset")
+	}
+	req, _ = http.NewRequest(http.MethodGet, ts.URL+FragmentPath+operation.Hash, nil)
+	req.Header.Set(OperationHeader, EncodeOperation(operation))
+	req.Header.Set("Range", "bytes=5000-")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Content-Range") != fmt.Sprintf("bytes 5000-%d/%d", len(data)-1, len(data)) {
+		t.Errorf("range of partial content should be declared: %s", resp.Header.Get("Content-Range"))
+	}
+
+	// The size claimed by the operation isn't trusted.
+	operation = newTestOperation(data, int64(len(data))*2)
+	accounts[operation.Address] = operation.PublicKey
+	req.Header.Set(OperationHeader, EncodeOperation(operation))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Content-Range") != fmt.Sprintf("bytes 5000-%d/%d", len(data)-1, len(data)) {
+		t.Errorf("range should be declared by the size stored: %s", resp.Header.Get("Content-Range"))
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", len(data)))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("range out of fragment stored should be rejected: %s", resp.Status)
+	}
+}
+
+func TestServer_Unauthorized(t *testing.T) {
+	ts, _, accounts, clean := newTestServer(t)
+	defer clean()
+	data := []byte("fragment")
+	operation := newTestOperation(data, int64(len(data)))
+	accounts[operation.Address] = operation.PublicKey
+	operation.Size++
+	client := NewClient()
+	err := client.Upload(ts.URL, operation, bytes.NewReader(data))
+	if err != ErrUnauthorized {
+		t.Error("operation modified should be rejected")
+	}
+	operation = newTestOperation(data, int64(len(data)))
+	accounts[operation.Address] = operation.PublicKey
+	operation.Sea = "other"
+	_, err = client.Download(ts.URL, operation, "", 0, ioutil.Discard)
+	if err != ErrUnauthorized {
+		t.Error("operation for other sea should be rejected")
+	}
+	// The operation signed by the key isn't the device of owner.
+	operation = newTestOperation(data, int64(len(data)))
+	err = client.Upload(ts.URL, operation, bytes.NewReader(data))
+	if err != ErrUnauthorized {
+		t.Error("operation signed by other key should be rejected")
+	}
+}
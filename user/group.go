@@ -17,7 +17,9 @@ package user
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
 	"github.com/yellowssi/SeaStorage-TP/storage"
+	"sort"
 )
 
 type Role uint8
@@ -29,24 +31,47 @@ var (
 	RoleOwner      Role = 4
 )
 
+// Group is the storage shared by members.
+// The master key of group is wrapped by the public key of each member and stored in Keys,
+// the file keys in Root are encrypted by the master key.
 type Group struct {
-	Name    string
-	Leader  string
-	Members map[string]Role
-	Root    *storage.Root
+	Name     string
+	Leader   string
+	Members  map[string]Role
+	Keys     []MemberKey // sorted by member
+	KeyEpoch uint64      // increased when the master key rotated
+	Root     *storage.Root
 }
 
-func NewGroup(name, leader string, members map[string]Role, root *storage.Root) *Group {
+// MemberKey is the master key wrapped by the public key of member.
+type MemberKey struct {
+	Member string // member address
+	Key    string
+}
+
+// Convert the wrapped keys by member addresses to the slice sorted by member.
+func newMemberKeys(keys map[string]string) []MemberKey {
+	memberKeys := make([]MemberKey, 0, len(keys))
+	for member, key := range keys {
+		memberKeys = append(memberKeys, MemberKey{Member: member, Key: key})
+	}
+	sort.Slice(memberKeys, func(i, j int) bool { return memberKeys[i].Member < memberKeys[j].Member })
+	return memberKeys
+}
+
+func NewGroup(name, leader string, members map[string]Role, keys map[string]string, root *storage.Root) *Group {
 	return &Group{
-		Name:    name,
-		Leader:  leader,
-		Members: members,
-		Root:    root,
+		Name:     name,
+		Leader:   leader,
+		Members:  members,
+		Keys:     newMemberKeys(keys),
+		KeyEpoch: 0,
+		Root:     root,
 	}
 }
 
-func GenerateGroup(name, leader string) *Group {
-	return NewGroup(name, leader, map[string]Role{leader: RoleOwner}, storage.GenerateRoot())
+func GenerateGroup(name, leader, key string) *Group {
+	return NewGroup(name, leader, map[string]Role{leader: RoleOwner}, map[string]string{leader: key}, storage.GenerateRoot())
 }
 
 func (g *Group) UpdateLeader(user, newLeader string) bool {
@@ -67,14 +92,82 @@ func (g *Group) UpdateMemberRole(user, member string, role Role) bool {
 	return true
 }
 
-func (g *Group) RemoveMember(user, member string) bool {
+// AddMember add the member with the master key wrapped by its public key.
+func (g *Group) AddMember(user, member string, role Role, key string) error {
 	if g.Members[user] != RoleOwner {
-		return false
+		return errors.New("only owner can add member")
+	}
+	if _, ok := g.Members[member]; ok {
+		return errors.New("member exists")
+	}
+	if key == "" {
+		return errors.New("wrapped key of member shouldn't be nil")
+	}
+	g.Members[member] = role
+	i := g.searchKey(member)
+	g.Keys = append(g.Keys, MemberKey{})
+	copy(g.Keys[i+1:], g.Keys[i:])
+	g.Keys[i] = MemberKey{Member: member, Key: key}
+	return nil
+}
+
+// RemoveMember remove the member and rotate the master key,
+// so that the removed member can't decrypt the files anymore.
+// The keys are the new master key wrapped for the remaining members,
+// the fileKeys are the file keys encrypted by the new master key.
+func (g *Group) RemoveMember(user, member string, keys, fileKeys map[string]string) error {
+	if g.Members[user] != RoleOwner {
+		return errors.New("only owner can remove member")
+	} else if _, ok := g.Members[member]; !ok {
+		return errors.New("member doesn't exists")
+	} else if member == g.Leader {
+		return errors.New("leader can't be removed")
 	} else if g.Members[member] == RoleOwner && g.Leader != user {
-		return false
+		return errors.New("only leader can remove owner")
 	}
+	role := g.Members[member]
 	delete(g.Members, member)
-	return true
+	err := g.RotateKey(keys, fileKeys)
+	if err != nil {
+		g.Members[member] = role
+		return err
+	}
+	return nil
+}
+
+// RotateKey replace the master key wrapped for every member and the file keys encrypted by it.
+func (g *Group) RotateKey(keys, fileKeys map[string]string) error {
+	if len(keys) != len(g.Members) {
+		return errors.New("wrapped keys should be provided for every member")
+	}
+	for member := range g.Members {
+		if keys[member] == "" {
+			return errors.New("wrapped key of member is nil: " + member)
+		}
+	}
+	err := g.Root.Keys.ReplaceKeys(fileKeys)
+	if err != nil {
+		return err
+	}
+	g.Keys = newMemberKeys(keys)
+	g.KeyEpoch++
+	return nil
+}
+
+// GetKey returns the master key wrapped for the member.
+func (g *Group) GetKey(member string) (string, error) {
+	i := g.searchKey(member)
+	if i == len(g.Keys) || g.Keys[i].Member != member {
+		return "", errors.New("member doesn't exists")
+	}
+	return g.Keys[i].Key, nil
+}
+
+// Returns the position of member in the sorted keys.
+func (g *Group) searchKey(member string) int {
+	return sort.Search(len(g.Keys), func(i int) bool {
+		return g.Keys[i].Member >= member
+	})
 }
 
 func (g *Group) ToBytes() []byte {
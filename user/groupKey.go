@@ -0,0 +1,85 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package user
+
+import (
+	"github.com/yellowssi/SeaStorage-TP/crypto"
+)
+
+// GroupKeyLength is the length of the master key of group in bits.
+const GroupKeyLength = 256
+
+// NewGroupKey generate the random master key of group.
+func NewGroupKey() string {
+	return crypto.NewAESKey(GroupKeyLength)
+}
+
+// WrapKey wrap the master key by the public keys of members.
+// It returns the wrapped keys by the same member addresses.
+func WrapKey(key string, publicKeys map[string]string) (map[string]string, error) {
+	keys := make(map[string]string, len(publicKeys))
+	for member, publicKey := range publicKeys {
+		wrapped, err := crypto.Encryption(publicKey, key)
+		if err != nil {
+			return nil, err
+		}
+		keys[member] = crypto.BytesToHex(wrapped)
+	}
+	return keys, nil
+}
+
+// UnwrapKey unwrap the master key by the private key of member.
+func UnwrapKey(privateKey, wrapped string) (string, error) {
+	key, err := crypto.Decryption(privateKey, wrapped)
+	if err != nil {
+		return "", err
+	}
+	return crypto.BytesToHex(key), nil
+}
+
+// EncryptFileKey encrypt the file key by the master key of group.
+func EncryptFileKey(masterKey, key string) (string, error) {
+	encrypted, err := crypto.AESKeyEncryption(masterKey, key)
+	if err != nil {
+		return "", err
+	}
+	return crypto.BytesToHex(encrypted), nil
+}
+
+// DecryptFileKey decrypt the file key encrypted by the master key of group.
+func DecryptFileKey(masterKey, encrypted string) (string, error) {
+	key, err := crypto.AESKeyDecryption(masterKey, encrypted)
+	if err != nil {
+		return "", err
+	}
+	return crypto.BytesToHex(key), nil
+}
+
+// RewrapFileKeys decrypt the file keys by the old master key and encrypt them by the new one.
+// The keys are by index, it is used when the master key rotated.
+func RewrapFileKeys(oldMasterKey, newMasterKey string, keys map[string]string) (map[string]string, error) {
+	result := make(map[string]string, len(keys))
+	for index, encrypted := range keys {
+		key, err := DecryptFileKey(oldMasterKey, encrypted)
+		if err != nil {
+			return nil, err
+		}
+		result[index], err = EncryptFileKey(newMasterKey, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,85 @@
+// Copyright © 2019 yellowsea <hh1271941291@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package user
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/yellowssi/SeaStorage-TP/crypto"
+	"strconv"
+)
+
+// The versions of the bytes of operation signed by the user.
+const (
+	// OperationVersionLegacy is the raw concatenation of fields, which is ambiguous.
+	// It is only accepted in verification for the operations signed before.
+	OperationVersionLegacy uint8 = 0
+	// OperationVersion1 is the domain tag followed by the length prefixed fields.
+	OperationVersion1 uint8 = 1
+	// OperationVersion is the version used by NewOperation.
+	OperationVersion = OperationVersion1
+)
+
+// OperationDomain separates the signature of operation from other messages signed by the same key.
+const OperationDomain = "SeaStorage/Operation"
+
+// The bytes of operation signed by the user in its version.
+// It returns nil if the version is unknown.
+func (o *Operation) signBytes() []byte {
+	switch o.Version {
+	case OperationVersionLegacy:
+		return o.legacySignBytes()
+	case OperationVersion1:
+		return o.v1SignBytes()
+	default:
+		return nil
+	}
+}
+
+// The bytes signed by the operations before versioned, the nonce isn't included.
+func (o *Operation) legacySignBytes() []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(o.Size))
+	return bytes.Join([][]byte{[]byte(o.Address + o.PublicKey + o.Sea + o.Path + o.Name + o.Hash), buf, []byte(strconv.Itoa(int(o.Timestamp)))}, []byte{})
+}
+
+// The domain tag and version are followed by the fields,
+// each string is prefixed by its length in 4 bytes and each integer is in 8 bytes, all in big endian.
+func (o *Operation) v1SignBytes() []byte {
+	var buf bytes.Buffer
+	writeString := func(s string) {
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(s)))
+		buf.WriteString(s)
+	}
+	writeString(OperationDomain)
+	buf.WriteByte(OperationVersion1)
+	for _, field := range []string{o.Address, o.PublicKey, o.Sea, o.Path, o.Name, o.Hash} {
+		writeString(field)
+	}
+	for _, field := range []uint64{uint64(o.Size), uint64(o.Timestamp), o.Nonce} {
+		_ = binary.Write(&buf, binary.BigEndian, field)
+	}
+	return buf.Bytes()
+}
+
+// The key to detect the replay of operation.
+// The nonce isn't signed in the legacy version, so the key is derived from the bytes signed instead,
+// the signature isn't used because it is malleable.
+func (o *Operation) replayKey() uint64 {
+	if o.Version == OperationVersionLegacy {
+		return binary.BigEndian.Uint64(crypto.SHA512BytesFromBytes(o.legacySignBytes()))
+	}
+	return o.Nonce
+}
@@ -16,25 +16,41 @@ package user
 
 import (
 	"bytes"
-	"encoding/binary"
 	"encoding/gob"
+	"errors"
 	"github.com/hyperledger/sawtooth-sdk-go/signing"
 	"github.com/yellowssi/SeaStorage-TP/crypto"
 	"github.com/yellowssi/SeaStorage-TP/storage"
-	"strconv"
+	"sort"
+	"time"
 )
 
+// User is the account of storage.
+// PublicKey is the key of device created the account, the address of user is derived from it.
+// Devices are the public keys authorized to act on the account.
 type User struct {
 	PublicKey string
+	Devices   []string
 	Groups    []string
 	Root      *storage.Root
+	Balance   int64
+	Consumed  []ConsumedNonce // sorted by nonce
+}
+
+// ConsumedNonce is the nonce of operation consumed by the user and its deadline.
+type ConsumedNonce struct {
+	Nonce    uint64
+	Deadline int64
 }
 
 func NewUser(publicKey string, groups []string, root *storage.Root) *User {
 	return &User{
 		PublicKey: publicKey,
+		Devices:   []string{publicKey},
 		Groups:    groups,
 		Root:      root,
+		Balance:   0,
+		Consumed:  make([]ConsumedNonce, 0),
 	}
 }
 
@@ -42,8 +58,48 @@ func GenerateUser(publicKey string) *User {
 	return NewUser(publicKey, make([]string, 0), storage.GenerateRoot())
 }
 
+// VerifyPublicKey check the public key whether authorized device of user.
+// The user created without devices is only authorized to its public key.
 func (u *User) VerifyPublicKey(publicKey string) bool {
-	return publicKey == u.PublicKey
+	if len(u.Devices) == 0 {
+		return publicKey == u.PublicKey
+	}
+	for _, device := range u.Devices {
+		if device == publicKey {
+			return true
+		}
+	}
+	return false
+}
+
+// AddDevice authorize the public key of device to act on the account.
+func (u *User) AddDevice(publicKey string) error {
+	if publicKey == "" {
+		return errors.New("public key of device shouldn't be nil")
+	}
+	if len(u.Devices) == 0 {
+		u.Devices = []string{u.PublicKey}
+	}
+	if u.VerifyPublicKey(publicKey) {
+		return errors.New("device exists")
+	}
+	u.Devices = append(u.Devices, publicKey)
+	return nil
+}
+
+// RemoveDevice revoke the public key of device.
+// The public key created the account can't be removed, because the keys of files are wrapped by it.
+func (u *User) RemoveDevice(publicKey string) error {
+	if publicKey == u.PublicKey {
+		return errors.New("the public key wrapping the keys of files can't be removed")
+	}
+	for i, device := range u.Devices {
+		if device == publicKey {
+			u.Devices = append(u.Devices[:i], u.Devices[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("device doesn't exists")
 }
 
 func (u *User) JoinGroup(group string) bool {
@@ -75,6 +131,49 @@ func (u *User) IsInGroup(group string) bool {
 	return false
 }
 
+// Deposit add the amount to the balance of user.
+func (u *User) Deposit(amount int64) error {
+	if amount <= 0 {
+		return errors.New("amount of deposit should be positive")
+	}
+	u.Balance += amount
+	return nil
+}
+
+// Pay deduct the amount from the balance of user.
+// It returns the error if the balance is insufficient.
+func (u *User) Pay(amount int64) error {
+	if amount < 0 {
+		return errors.New("amount of payment shouldn't be negative")
+	}
+	if amount > u.Balance {
+		return errors.New("insufficient balance")
+	}
+	u.Balance -= amount
+	return nil
+}
+
+// ConsumeOperation record the nonce of operation, so that the operation with the same nonce can't be submitted twice.
+// The records expired at the time of block are removed, because the expired operations are rejected anyway.
+func (u *User) ConsumeOperation(o *Operation, now time.Time) error {
+	consumed := make([]ConsumedNonce, 0, len(u.Consumed)+1)
+	for _, c := range u.Consumed {
+		if c.Deadline >= now.Unix() {
+			consumed = append(consumed, c)
+		}
+	}
+	nonce := o.replayKey()
+	i := sort.Search(len(consumed), func(i int) bool { return consumed[i].Nonce >= nonce })
+	if i < len(consumed) && consumed[i].Nonce == nonce {
+		return errors.New("nonce of operation is consumed")
+	}
+	consumed = append(consumed, ConsumedNonce{})
+	copy(consumed[i+1:], consumed[i:])
+	consumed[i] = ConsumedNonce{Nonce: nonce, Deadline: o.Timestamp}
+	u.Consumed = consumed
+	return nil
+}
+
 func (u *User) ToBytes() []byte {
 	var buf bytes.Buffer
 	enc := gob.NewEncoder(&buf)
@@ -90,6 +189,8 @@ func UserFromBytes(data []byte) (*User, error) {
 	return u, err
 }
 
+// Operation is the authorization signed by the user for the sea to store the fragment.
+// Nonce is chosen by the user and can be consumed only once, so that the operation can't be replayed.
 type Operation struct {
 	Address   string
 	PublicKey string
@@ -99,14 +200,13 @@ type Operation struct {
 	Size      int64
 	Hash      string
 	Timestamp int64
+	Nonce     uint64
+	Version   uint8
 	Signature string
 }
 
-func NewOperation(address, publicKey, sea, path, name, hash string, size, timestamp int64, signer signing.Signer) *Operation {
-	buf := make([]byte, 8)
-	binary.BigEndian.PutUint64(buf, uint64(size))
-	sign := signer.Sign(bytes.Join([][]byte{[]byte(address + publicKey + sea + path + name + hash), buf, []byte(strconv.Itoa(int(timestamp)))}, []byte{}))
-	return &Operation{
+func NewOperation(address, publicKey, sea, path, name, hash string, size, timestamp int64, nonce uint64, signer signing.Signer) *Operation {
+	o := &Operation{
 		Address:   address,
 		PublicKey: publicKey,
 		Sea:       sea,
@@ -115,16 +215,27 @@ func NewOperation(address, publicKey, sea, path, name, hash string, size, timest
 		Size:      size,
 		Hash:      hash,
 		Timestamp: timestamp,
-		Signature: crypto.BytesToHex(sign),
+		Nonce:     nonce,
+		Version:   OperationVersion,
 	}
+	o.Signature = crypto.BytesToHex(signer.Sign(o.signBytes()))
+	return o
 }
 
-func (o *Operation) Verify() bool {
+// Verify check the signature of operation in its version.
+// The operation signed in the legacy version is only verified if acceptLegacy,
+// which should be the same for every validator, and it shouldn't carry the nonce which isn't signed.
+func (o *Operation) Verify(acceptLegacy bool) bool {
+	if o.Version == OperationVersionLegacy && (!acceptLegacy || o.Nonce != 0) {
+		return false
+	}
+	data := o.signBytes()
+	if data == nil {
+		return false
+	}
 	pub := signing.NewSecp256k1PublicKey(crypto.HexToBytes(o.PublicKey))
 	cont := signing.NewSecp256k1Context()
-	buf := make([]byte, 8)
-	binary.BigEndian.PutUint64(buf, uint64(o.Size))
-	return cont.Verify(crypto.HexToBytes(o.Signature), bytes.Join([][]byte{[]byte(o.Address + o.PublicKey + o.Sea + o.Path + o.Name + o.Hash), buf, []byte(strconv.Itoa(int(o.Timestamp)))}, []byte{}), pub)
+	return cont.Verify(crypto.HexToBytes(o.Signature), data, pub)
 }
 
 func (o *Operation) ToBytes() []byte {
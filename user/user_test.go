@@ -2,6 +2,8 @@ package user
 
 import (
 	"github.com/hyperledger/sawtooth-sdk-go/signing"
+	"github.com/yellowssi/SeaStorage-TP/crypto"
+	"github.com/yellowssi/SeaStorage-TP/storage"
 	"testing"
 	"time"
 )
@@ -15,9 +17,9 @@ func init() {
 }
 
 func TestOperation(t *testing.T) {
-	o := NewOperation("address", signer.GetPublicKey().AsHex(), "sea", "path", "name", "hash", 10, time.Now().Unix(), *signer)
+	o := NewOperation("address", signer.GetPublicKey().AsHex(), "sea", "path", "name", "hash", 10, time.Now().Unix(), 0, *signer)
 	t.Log(o)
-	result := o.Verify()
+	result := o.Verify(false)
 	t.Log("Verify result:", result)
 	data := o.ToBytes()
 	testOperation, err := OperationFromBytes(data)
@@ -26,3 +28,201 @@ func TestOperation(t *testing.T) {
 	}
 	t.Log(testOperation)
 }
+
+func TestUser_Pay(t *testing.T) {
+	u := GenerateUser(signer.GetPublicKey().AsHex())
+	err := u.Deposit(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Pay(20) == nil {
+		t.Error("payment should be rejected with insufficient balance")
+	}
+	err = u.Pay(10)
+	if err != nil || u.Balance != 0 {
+		t.Error("payment should be deducted from balance")
+	}
+}
+
+func TestUser_ConsumeOperation(t *testing.T) {
+	u := GenerateUser(signer.GetPublicKey().AsHex())
+	now := time.Now()
+	o := NewOperation("address", signer.GetPublicKey().AsHex(), "sea", "path", "name", "hash", 10, now.Add(time.Hour).Unix(), 1, *signer)
+	err := u.ConsumeOperation(o, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ConsumeOperation(o, now) == nil {
+		t.Error("operation shouldn't be consumed twice")
+	}
+	other := NewOperation("address", signer.GetPublicKey().AsHex(), "sea", "path", "name", "other", 10, now.Add(time.Hour).Unix(), 1, *signer)
+	if u.ConsumeOperation(other, now) == nil {
+		t.Error("nonce shouldn't be consumed twice")
+	}
+	other.Nonce = 2
+	if other.Verify(false) {
+		t.Error("nonce should be signed")
+	}
+	u.ConsumeOperation(NewOperation("address", signer.GetPublicKey().AsHex(), "sea", "path", "name", "other", 10, now.Add(time.Hour).Unix(), 2, *signer), now.Add(2*time.Hour))
+	if len(u.Consumed) != 1 {
+		t.Error("expired records should be removed")
+	}
+}
+
+// The test vectors of signing operation by the private key 1.
+var operationVectors = []struct {
+	version   uint8
+	nonce     uint64
+	signBytes string
+	signature string
+}{{
+	version:   OperationVersion1,
+	nonce:     7,
+	signBytes: "0000001453656153746f726167652f4f7065726174696f6e01000000026162000000423032373962653636376566396463626261633535613036323935636538373062303730323962666364623264636532386439353966323831356231366638313739380000000163000000012f000000016e0000000168000000000000000a0000000059682f000000000000000007",
+	signature: "e9cdb0121395b6a18ec31cafa8f5a8341137bab4d722b9d8b77f8ea0fd4e24833252c59c37caabc06fb9c3d6f002450782547e3bbda9aae4439c86f58126676b",
+}, {
+	version:   OperationVersionLegacy,
+	nonce:     0,
+	signBytes: "6162303237396265363637656639646362626163353561303632393563653837306230373032396266636462326463653238643935396632383135623136663831373938632f6e68000000000000000a31353030303030303030",
+	signature: "966e7146097dac24f8bbe13f54e0188aae291cc935e5b95afaced430fb81447c6f9a5112ffb416909aaa2596577e81858dda6040513be912b00ded7bb55e9b75",
+}}
+
+func TestOperation_Vectors(t *testing.T) {
+	publicKey := "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	for _, vector := range operationVectors {
+		o := &Operation{Address: "ab", PublicKey: publicKey, Sea: "c", Path: "/", Name: "n", Hash: "h", Size: 10, Timestamp: 1500000000, Nonce: vector.nonce, Version: vector.version, Signature: vector.signature}
+		if crypto.BytesToHex(o.signBytes()) != vector.signBytes {
+			t.Errorf("invalid sign bytes of version %d", vector.version)
+		}
+		if !o.Verify(true) {
+			t.Errorf("signature of version %d should be verified", vector.version)
+		}
+	}
+}
+
+func TestOperation_Ambiguous(t *testing.T) {
+	timestamp := time.Now().Unix()
+	o := NewOperation("ab", signer.GetPublicKey().AsHex(), "sea", "path", "name", "hash", 10, timestamp, 0, *signer)
+	moved := *o
+	moved.Path, moved.Name = "pat", "hname"
+	if moved.Verify(true) {
+		t.Error("fields moved between each other shouldn't be verified")
+	}
+	moved.Version = OperationVersionLegacy
+	legacy := NewOperation("ab", signer.GetPublicKey().AsHex(), "sea", "path", "name", "hash", 10, timestamp, 0, *signer)
+	legacy.Version = OperationVersionLegacy
+	legacy.Signature = crypto.BytesToHex(signer.Sign(legacy.signBytes()))
+	moved.Signature = legacy.Signature
+	if !moved.Verify(true) {
+		t.Error("legacy format is ambiguous")
+	}
+	if legacy.Verify(false) {
+		t.Error("legacy operation shouldn't be verified if it isn't accepted")
+	}
+	legacy.Nonce = 1
+	if legacy.Verify(true) {
+		t.Error("legacy operation shouldn't carry the nonce which isn't signed")
+	}
+}
+
+func TestGroup_RemoveMember(t *testing.T) {
+	cont := signing.NewSecp256k1Context()
+	leaderPriv := cont.NewRandomPrivateKey()
+	memberPriv := cont.NewRandomPrivateKey()
+	publicKeys := map[string]string{
+		"leader": cont.GetPublicKey(leaderPriv).AsHex(),
+		"member": cont.GetPublicKey(memberPriv).AsHex(),
+	}
+	masterKey := NewGroupKey()
+	keys, err := WrapKey(masterKey, publicKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := GenerateGroup("group", "leader", keys["leader"])
+	err = g.AddMember("leader", "member", RoleDeveloper, keys["member"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, _ := g.GetKey("member")
+	key, err := UnwrapKey(memberPriv.AsHex(), wrapped)
+	if err != nil || key != masterKey {
+		t.Error("member should unwrap the master key", err)
+	}
+	fileKey := crypto.NewAESKey(256)
+	encrypted, err := EncryptFileKey(masterKey, fileKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := crypto.SHA512HexFromHex(fileKey)
+	g.Root.Keys.Keys = append(g.Root.Keys.Keys, &storage.FileKey{Index: index, Used: 1, Key: encrypted})
+
+	newMasterKey := NewGroupKey()
+	delete(publicKeys, "member")
+	newKeys, _ := WrapKey(newMasterKey, publicKeys)
+	if g.RemoveMember("leader", "member", newKeys, map[string]string{}) == nil {
+		t.Error("file keys should be rotated when member removed")
+	}
+	if _, ok := g.Members["member"]; !ok {
+		t.Error("member shouldn't be removed when rotation failed")
+	}
+	fileKeys, err := RewrapFileKeys(masterKey, newMasterKey, map[string]string{index: encrypted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.RemoveMember("leader", "member", newKeys, fileKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = g.GetKey("member"); err == nil || g.KeyEpoch != 1 {
+		t.Error("removed member shouldn't have the master key")
+	}
+	key, err = DecryptFileKey(newMasterKey, g.Root.Keys.GetKey(index).Key)
+	if err != nil || key != fileKey {
+		t.Error("file key should be encrypted by the new master key", err)
+	}
+	g = GenerateGroup("group", "z", "key z")
+	_ = g.AddMember("z", "a", RoleGuest, "key a")
+	if len(g.Keys) != 2 || g.Keys[0].Member != "a" || g.Keys[1].Member != "z" {
+		t.Error("keys should be sorted by member")
+	}
+}
+
+func TestUser_Devices(t *testing.T) {
+	u := GenerateUser("device0")
+	err := u.AddDevice("device1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.VerifyPublicKey("device0") || !u.VerifyPublicKey("device1") {
+		t.Error("all devices should be authorized")
+	}
+	if u.AddDevice("device1") == nil {
+		t.Error("device shouldn't be added twice")
+	}
+	if u.RemoveDevice("device0") == nil {
+		t.Error("the public key wrapping the keys shouldn't be removed")
+	}
+	err = u.RemoveDevice("device1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.VerifyPublicKey("device1") {
+		t.Error("removed device shouldn't be authorized")
+	}
+}
+
+func TestUser_ConsumeOperationSorted(t *testing.T) {
+	u := GenerateUser(signer.GetPublicKey().AsHex())
+	now := time.Now()
+	for _, nonce := range []uint64{5, 1, 3} {
+		err := u.ConsumeOperation(&Operation{Nonce: nonce, Version: OperationVersion, Timestamp: now.Add(time.Hour).Unix()}, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i < len(u.Consumed); i++ {
+		if u.Consumed[i-1].Nonce >= u.Consumed[i].Nonce {
+			t.Error("consumed nonces should be sorted")
+		}
+	}
+}